@@ -1,20 +1,172 @@
 package config
 
 import (
+	"time"
+
 	"github.com/caarlos0/env/v6"
 	"github.com/pkg/errors"
 )
 
 type Config struct {
-	Port        int      `env:"HTTP_PORT" json:"port"`
-	ENV         string   `env:"LOG_ENV" envDefault:"dev" json:"env"`
-	Services    Services `json:"services"`
-	TokenSecret string   `env:"TOKEN_SECRET" json:"-"`
-	ServiceName string   `env:"SERVICE_NAME" envDefault:"apigw-ext" json:"serviceName"`
+	Port            int        `env:"HTTP_PORT" json:"port"`
+	AdminPort       int        `env:"ADMIN_PORT" envDefault:"9090" json:"adminPort"`
+	ENV             string     `env:"LOG_ENV" envDefault:"dev" json:"env"`
+	Services        Services   `json:"services"`
+	TokenSecret     string     `env:"TOKEN_SECRET" envDefault:"" json:"-" log:"redact"`
+	JWKS            JWKS       `json:"jwks"`
+	Redis           Redis      `json:"redis"`
+	Revocation      Revocation `json:"revocation"`
+	Identity        Identity   `json:"identity"`
+	RateLimit       RateLimit  `json:"rateLimit"`
+	Lockout         Lockout    `json:"lockout"`
+	Tracing         Tracing    `json:"tracing"`
+	Audit           Audit      `json:"audit"`
+	Shutdown        Shutdown   `json:"shutdown"`
+	HTTPS           HTTPS      `json:"https"`
+	ServiceName     string     `env:"SERVICE_NAME" envDefault:"apigw-ext" json:"serviceName"`
+	RoutesPath      string     `env:"ROUTES_PATH" envDefault:"config/routes.yaml" json:"routesPath"`
+	RequestIdHeader string     `env:"REQUEST_ID_HEADER" envDefault:"X-Request-ID" json:"requestIdHeader"`
+	// AccessLogSample is the share of successful requests written to the access log.
+	AccessLogSample float64 `env:"ACCESS_LOG_SUCCESS_SAMPLE" envDefault:"1" json:"accessLogSample"`
+	// LogRedactKeys lists extra field names whose values are masked in logs.
+	LogRedactKeys []string `env:"LOG_REDACT_KEYS" envDefault:"" envSeparator:"," json:"logRedactKeys"`
+	// DescriptorSetPath points to a compiled FileDescriptorSet used by rpc routes.
+	// When empty, the descriptors compiled into the gateway are used.
+	DescriptorSetPath string `env:"DESCRIPTOR_SET_PATH" envDefault:"" json:"descriptorSetPath"`
+	// MaxBodyBytes bounds the request body of rpc routes.
+	MaxBodyBytes int64 `env:"MAX_BODY_BYTES" envDefault:"1048576" json:"maxBodyBytes"`
+	// HealthCheckTimeout bounds a single /readyz evaluation.
+	HealthCheckTimeout time.Duration `env:"HEALTH_CHECK_TIMEOUT" envDefault:"2s" json:"healthCheckTimeout"`
+	// TrustedProxies lists the IPs or CIDRs of proxies in front of the gateway
+	// whose X-Forwarded-For is believed. By default none are trusted.
+	TrustedProxies []string `env:"TRUSTED_PROXIES" envDefault:"" envSeparator:"," json:"trustedProxies"`
+	// APIKeysFile stores hashed API keys managed through the admin endpoints.
+	APIKeysFile string `env:"API_KEYS_FILE" envDefault:"apikeys.json" json:"apiKeysFile"`
+	// APIKeysReloadInterval is how often the file is checked for keys created
+	// or revoked by other replicas.
+	APIKeysReloadInterval time.Duration `env:"API_KEYS_RELOAD_INTERVAL" envDefault:"10s" json:"apiKeysReloadInterval"`
+}
+
+// JWKS configures verification of asymmetrically signed tokens. Source is a
+// local file path or an http(s) URL; leave it empty to accept HMAC tokens only.
+type JWKS struct {
+	Source          string        `env:"JWKS_SOURCE" envDefault:"" json:"source"`
+	RefreshInterval time.Duration `env:"JWKS_REFRESH_INTERVAL" envDefault:"5m" json:"refreshInterval"`
+	RotationGrace   time.Duration `env:"JWKS_ROTATION_GRACE" envDefault:"1h" json:"rotationGrace"`
+}
+
+type Redis struct {
+	Addr     string `env:"REDIS_ADDR" envDefault:"" json:"addr"`
+	Password string `env:"REDIS_PASSWORD" envDefault:"" json:"-"`
+	DB       int    `env:"REDIS_DB" envDefault:"0" json:"db"`
+}
+
+// Revocation configures the token deny-list. Store is either memory or redis;
+// TTL should be at least the lifetime of an access token.
+type Revocation struct {
+	Store string        `env:"REVOCATION_STORE" envDefault:"memory" json:"store"`
+	TTL   time.Duration `env:"REVOCATION_TTL" envDefault:"24h" json:"ttl"`
+}
+
+// Identity configures how the caller identity is forwarded upstream. Mode is
+// none, metadata or headers; setting InternalTokenSecret additionally attaches
+// a gateway-signed JWT.
+type Identity struct {
+	Mode                string        `env:"IDENTITY_PROPAGATION" envDefault:"metadata" json:"mode"`
+	InternalTokenSecret string        `env:"INTERNAL_TOKEN_SECRET" envDefault:"" json:"-"`
+	InternalTokenTTL    time.Duration `env:"INTERNAL_TOKEN_TTL" envDefault:"1m" json:"internalTokenTtl"`
+}
+
+// RateLimit selects where rate limit counters live: memory or redis.
+// Limits themselves are declared per route in the route table.
+type RateLimit struct {
+	Store string `env:"RATE_LIMIT_STORE" envDefault:"memory" json:"store"`
+}
+
+// Lockout configures brute-force protection of the login endpoint. Failures
+// are counted per email and per client IP within FailureWindow.
+type Lockout struct {
+	EmailThreshold int           `env:"LOGIN_EMAIL_THRESHOLD" envDefault:"5" json:"emailThreshold"`
+	IPThreshold    int           `env:"LOGIN_IP_THRESHOLD" envDefault:"20" json:"ipThreshold"`
+	BaseDelay      time.Duration `env:"LOGIN_LOCKOUT_BASE" envDefault:"30s" json:"baseDelay"`
+	MaxDelay       time.Duration `env:"LOGIN_LOCKOUT_MAX" envDefault:"1h" json:"maxDelay"`
+	FailureWindow  time.Duration `env:"LOGIN_FAILURE_WINDOW" envDefault:"15m" json:"failureWindow"`
+}
+
+// Tracing selects the span exporter: none, otlp, stdout or file.
+type Tracing struct {
+	Exporter     string  `env:"TRACING_EXPORTER" envDefault:"none" json:"exporter"`
+	OTLPEndpoint string  `env:"OTLP_ENDPOINT" envDefault:"localhost:4317" json:"otlpEndpoint"`
+	OTLPInsecure bool    `env:"OTLP_INSECURE" envDefault:"false" json:"otlpInsecure"`
+	FilePath     string  `env:"TRACING_FILE" envDefault:"traces.jsonl" json:"filePath"`
+	SampleRatio  float64 `env:"TRACING_SAMPLE_RATIO" envDefault:"1" json:"sampleRatio"`
+}
+
+// Audit configures the record of administrative actions. Entries are appended
+// to FilePath and, when WebhookURL is set, posted to it as well. QueueSize
+// bounds the entries waiting to be written.
+type Audit struct {
+	FilePath       string        `env:"AUDIT_FILE" envDefault:"audit.jsonl" json:"filePath"`
+	WebhookURL     string        `env:"AUDIT_WEBHOOK_URL" envDefault:"" json:"webhookUrl"`
+	WebhookTimeout time.Duration `env:"AUDIT_WEBHOOK_TIMEOUT" envDefault:"5s" json:"webhookTimeout"`
+	Recent         int           `env:"AUDIT_RECENT_ENTRIES" envDefault:"1000" json:"recent"`
+	QueueSize      int           `env:"AUDIT_QUEUE_SIZE" envDefault:"1000" json:"queueSize"`
+}
+
+// Shutdown configures graceful termination. PreStopDelay keeps the gateway
+// serving after /readyz starts failing; DrainTimeout bounds in-flight requests.
+// Together they must stay below the pod's terminationGracePeriodSeconds
+// (30s by default in Kubernetes), or the gateway is killed mid-drain.
+type Shutdown struct {
+	PreStopDelay time.Duration `env:"SHUTDOWN_PRE_STOP_DELAY" envDefault:"5s" json:"preStopDelay"`
+	DrainTimeout time.Duration `env:"SHUTDOWN_DRAIN_TIMEOUT" envDefault:"20s" json:"drainTimeout"`
+}
+
+// HTTPS terminates TLS on the public port. CertFiles and KeyFiles are matched
+// by position and the certificate is chosen by SNI. ClientCAFile enables
+// client certificate authentication for groups that accept client_cert.
+// RedirectPort, when set, serves plain HTTP that redirects to HTTPS. H2C
+// enables cleartext HTTP/2 when HTTPS is off, for deployments behind a
+// TLS-terminating proxy.
+type HTTPS struct {
+	Enabled        bool          `env:"HTTPS_ENABLED" envDefault:"false" json:"enabled"`
+	CertFiles      []string      `env:"HTTPS_CERT_FILES" envDefault:"" envSeparator:"," json:"certFiles"`
+	KeyFiles       []string      `env:"HTTPS_KEY_FILES" envDefault:"" envSeparator:"," json:"keyFiles"`
+	ClientCAFile   string        `env:"HTTPS_CLIENT_CA_FILE" envDefault:"" json:"clientCaFile"`
+	MinVersion     string        `env:"HTTPS_MIN_VERSION" envDefault:"1.2" json:"minVersion"`
+	ReloadInterval time.Duration `env:"HTTPS_RELOAD_INTERVAL" envDefault:"30s" json:"reloadInterval"`
+	RedirectPort   int           `env:"HTTPS_REDIRECT_PORT" envDefault:"0" json:"redirectPort"`
+	H2C            bool          `env:"H2C_ENABLED" envDefault:"false" json:"h2c"`
 }
 
 type Services struct {
-	AuthAddr string `env:"AUTH_ADDR" json:"authAddr"`
+	Auth Upstream `envPrefix:"AUTH_" json:"auth"`
+}
+
+// Upstream locates the replicas of a gRPC service. Addr is a comma separated
+// host:port list for static discovery, an SRV name for dns_srv or the path of
+// an endpoints file for file. Balancer is round_robin or least_request.
+type Upstream struct {
+	Addr            string        `env:"ADDR" json:"addr"`
+	Discovery       string        `env:"DISCOVERY" envDefault:"static" json:"discovery"`
+	Balancer        string        `env:"BALANCER" envDefault:"round_robin" json:"balancer"`
+	HealthCheck     bool          `env:"HEALTH_CHECK" envDefault:"true" json:"healthCheck"`
+	RefreshInterval time.Duration `env:"DISCOVERY_REFRESH" envDefault:"30s" json:"refreshInterval"`
+	TLS             ClientTLS     `envPrefix:"TLS_" json:"tls"`
+}
+
+// ClientTLS secures the connection to an upstream. Setting CertFile and
+// KeyFile enables mTLS; without CAFile the system roots are trusted. Files are
+// re-read when they change. The upstream certificate is verified against
+// ServerName or, when unset, the host of each dialled endpoint.
+type ClientTLS struct {
+	Enabled        bool          `env:"ENABLED" envDefault:"false" json:"enabled"`
+	CAFile         string        `env:"CA_FILE" envDefault:"" json:"caFile"`
+	CertFile       string        `env:"CERT_FILE" envDefault:"" json:"certFile"`
+	KeyFile        string        `env:"KEY_FILE" envDefault:"" json:"keyFile"`
+	ServerName     string        `env:"SERVER_NAME" envDefault:"" json:"serverName"`
+	MinVersion     string        `env:"MIN_VERSION" envDefault:"1.2" json:"minVersion"`
+	ReloadInterval time.Duration `env:"RELOAD_INTERVAL" envDefault:"30s" json:"reloadInterval"`
 }
 
 func MustParse() *Config {
@@ -23,5 +175,35 @@ func MustParse() *Config {
 	if err != nil {
 		panic(errors.Wrap(err, "filed to parse config"))
 	}
+	if cfg.TokenSecret == "" && cfg.JWKS.Source == "" {
+		panic(errors.New("either TOKEN_SECRET or JWKS_SOURCE must be set"))
+	}
+	switch cfg.Revocation.Store {
+	case "memory":
+	case "redis":
+		if cfg.Redis.Addr == "" {
+			panic(errors.New("REDIS_ADDR must be set for the redis revocation store"))
+		}
+	default:
+		panic(errors.Errorf("unknown revocation store %q", cfg.Revocation.Store))
+	}
+	switch cfg.RateLimit.Store {
+	case "memory":
+	case "redis":
+		if cfg.Redis.Addr == "" {
+			panic(errors.New("REDIS_ADDR must be set for the redis rate limit store"))
+		}
+	default:
+		panic(errors.Errorf("unknown rate limit store %q", cfg.RateLimit.Store))
+	}
+	if cfg.Lockout.EmailThreshold <= 0 || cfg.Lockout.IPThreshold <= 0 {
+		panic(errors.New("login lockout thresholds must be positive"))
+	}
+	if t := cfg.Services.Auth.TLS; t.Enabled && (t.CertFile == "") != (t.KeyFile == "") {
+		panic(errors.New("AUTH_TLS_CERT_FILE and AUTH_TLS_KEY_FILE must be set together"))
+	}
+	if cfg.HTTPS.Enabled && (len(cfg.HTTPS.CertFiles) == 0 || len(cfg.HTTPS.CertFiles) != len(cfg.HTTPS.KeyFiles)) {
+		panic(errors.New("HTTPS_CERT_FILES and HTTPS_KEY_FILES must list the same number of files"))
+	}
 	return cfg
 }
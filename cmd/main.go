@@ -1,14 +1,40 @@
 package main
 
 import (
+	"context"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
 	"github.com/vindosVP/snapigw/cmd/config"
+	"github.com/vindosVP/snapigw/internal/apikey"
+	"github.com/vindosVP/snapigw/internal/audit"
+	"github.com/vindosVP/snapigw/internal/certs"
+	"github.com/vindosVP/snapigw/internal/clientcert"
+	"github.com/vindosVP/snapigw/internal/discovery"
+	"github.com/vindosVP/snapigw/internal/health"
+	"github.com/vindosVP/snapigw/internal/identity"
+	"github.com/vindosVP/snapigw/internal/jwks"
+	"github.com/vindosVP/snapigw/internal/lockout"
+	"github.com/vindosVP/snapigw/internal/metrics"
+	"github.com/vindosVP/snapigw/internal/middleware"
+	"github.com/vindosVP/snapigw/internal/ratelimit"
+	"github.com/vindosVP/snapigw/internal/revocation"
+	"github.com/vindosVP/snapigw/internal/routes"
 	"github.com/vindosVP/snapigw/internal/server"
 	"github.com/vindosVP/snapigw/internal/services/auth"
+	"github.com/vindosVP/snapigw/internal/tracing"
+	"github.com/vindosVP/snapigw/internal/transcode"
+	"github.com/vindosVP/snapigw/internal/upstream"
 	"github.com/vindosVP/snapigw/pkg/logger"
 )
 
+const metricsNamespace = "apigw"
+
 var (
 	buildCommit = "N/A"
 	buildTime   = "N/A"
@@ -17,7 +43,7 @@ var (
 
 func main() {
 	cfg := config.MustParse()
-	l := logger.SetupLogger(cfg.ENV, cfg.ServiceName)
+	l := logger.SetupLogger(cfg.ENV, cfg.ServiceName, cfg.LogRedactKeys...).Hook(tracing.LogHook{})
 
 	l.Info().Str("env", cfg.ENV).
 		Str("buildCommit", buildCommit).
@@ -31,15 +57,236 @@ func main() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
+	var rdb *redis.Client
+	if cfg.Redis.Addr != "" {
+		rdb = redis.NewClient(&redis.Options{
+			Addr:     cfg.Redis.Addr,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+		defer rdb.Close()
+	}
+
+	var revoked revocation.Store
+	switch cfg.Revocation.Store {
+	case "redis":
+		revoked = revocation.NewRedisStore(rdb, cfg.Revocation.TTL)
+	default:
+		revoked = revocation.NewMemoryStore(cfg.Revocation.TTL)
+	}
+
+	propagator, err := identity.NewPropagator(cfg.Identity.Mode)
+	if err != nil {
+		l.Fatal().Err(err).Stack().Msg("failed to create identity propagator")
+	}
+	if cfg.Identity.InternalTokenSecret != "" {
+		propagator.WithInternalToken(cfg.ServiceName, cfg.Identity.InternalTokenSecret, cfg.Identity.InternalTokenTTL)
+	}
+
+	var limiter ratelimit.Store
+	switch cfg.RateLimit.Store {
+	case "redis":
+		limiter = ratelimit.NewRedisStore(rdb)
+	default:
+		limiter = ratelimit.NewMemoryStore()
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.ServiceName, version, tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.OTLPEndpoint,
+		Insecure:    cfg.Tracing.OTLPInsecure,
+		FilePath:    cfg.Tracing.FilePath,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		l.Fatal().Err(err).Stack().Msg("failed to set up tracing")
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			l.Error().Err(err).Msg("failed to flush traces")
+		}
+	}()
+
+	m := metrics.New(metricsNamespace, metrics.BuildInfo{
+		Version:   version,
+		Commit:    buildCommit,
+		BuildTime: buildTime,
+	})
+
+	auditFile, err := audit.NewFileSink(cfg.Audit.FilePath)
+	if err != nil {
+		l.Fatal().Err(err).Stack().Msg("failed to open audit log")
+	}
+	defer auditFile.Close()
+	sinks := []audit.Sink{auditFile}
+	if cfg.Audit.WebhookURL != "" {
+		sinks = append(sinks, audit.NewWebhookSink(cfg.Audit.WebhookURL, cfg.Audit.WebhookTimeout))
+	}
+	auditor := audit.New(l, cfg.Audit.Recent, cfg.Audit.QueueSize, sinks...)
+	defer auditor.Close()
+	history, err := auditFile.Tail(cfg.Audit.Recent)
+	if err != nil {
+		l.Error().Err(err).Msg("failed to load audit history")
+	}
+	auditor.Preload(history)
+
+	table, err := routes.Load(cfg.RoutesPath)
+	if err != nil {
+		l.Fatal().Err(err).Stack().Msg("failed to load routes")
+	}
+
+	hc := health.New(cfg.HealthCheckTimeout)
+
+	authCfg := table.Upstream("auth")
+	authInterceptors := []grpc.UnaryClientInterceptor{
+		authCfg.UnaryClientInterceptor(),
+		m.UnaryClientInterceptor(),
+		middleware.UpstreamCode(),
+	}
+	if authCfg.Breaker != nil {
+		br := upstream.NewBreaker("auth", *authCfg.Breaker).OnStateChange(breakerLogger(l, m))
+		authInterceptors = append([]grpc.UnaryClientInterceptor{br.UnaryClientInterceptor()}, authInterceptors...)
+		hc.WithInfo("auth_breaker", br.Check)
+	}
+
+	authTarget, authOpts, err := discovery.DialOptions("auth", discovery.Config{
+		Mode:        cfg.Services.Auth.Discovery,
+		Target:      cfg.Services.Auth.Addr,
+		Balancer:    cfg.Services.Auth.Balancer,
+		HealthCheck: cfg.Services.Auth.HealthCheck,
+		Refresh:     cfg.Services.Auth.RefreshInterval,
+	}, l)
+	if err != nil {
+		l.Fatal().Err(err).Stack().Msg("failed to configure auth discovery")
+	}
+	authOpts = append(authOpts,
+		grpc.WithUnaryInterceptor(upstream.Except([]string{health.CheckMethod}, authInterceptors...)),
+		tracing.ClientOption(),
+	)
+	if cfg.Services.Auth.TLS.Enabled {
+		rl, creds, err := clientTLS(cfg.Services.Auth.TLS, l)
+		if err != nil {
+			l.Fatal().Err(err).Stack().Msg("failed to configure auth tls")
+		}
+		defer rl.Close()
+		authOpts = append(authOpts, grpc.WithTransportCredentials(creds))
+	}
+
 	pxs := server.NewProxs()
-	ap, err := auth.NewProxy(cfg.Services.AuthAddr, l)
+	ap, err := auth.NewProxy(authTarget, l, authOpts...)
 	if err != nil {
 		l.Fatal().Err(err).Stack().Msg("failed to create auth proxy")
 	}
-	pxs.WithAuth(ap)
+	guard := lockout.NewGuard(
+		lockout.Policy{
+			Threshold: cfg.Lockout.EmailThreshold,
+			BaseDelay: cfg.Lockout.BaseDelay,
+			MaxDelay:  cfg.Lockout.MaxDelay,
+			Window:    cfg.Lockout.FailureWindow,
+		},
+		lockout.Policy{
+			Threshold: cfg.Lockout.IPThreshold,
+			BaseDelay: cfg.Lockout.BaseDelay,
+			MaxDelay:  cfg.Lockout.MaxDelay,
+			Window:    cfg.Lockout.FailureWindow,
+		},
+	)
+	ap.WithRevocation(revoked).WithPropagator(propagator).WithLockout(guard).WithAuditor(auditor)
+	pxs.With("auth", ap)
+	pxs.With("audit", auditor)
+
+	keys, err := apikey.NewFileStore(cfg.APIKeysFile, l, cfg.APIKeysReloadInterval)
+	if err != nil {
+		l.Fatal().Err(err).Stack().Msg("failed to load api keys")
+	}
+	defer keys.Close()
+	tiers := make([]string, 0, len(table.APIKeyTiers))
+	for name := range table.APIKeyTiers {
+		tiers = append(tiers, name)
+	}
+	pxs.With("apikeys", apikey.NewAdmin(keys, l).
+		WithTiers(tiers).
+		WithDefaultTier(table.DefaultAPIKeyTier).
+		WithScopes(table.APIKeyScopes))
+
+	tc, err := transcode.New(cfg.DescriptorSetPath, l)
+	if err != nil {
+		l.Fatal().Err(err).Stack().Msg("failed to create transcoder")
+	}
+	tc.WithPropagator(propagator).WithMaxBodyBytes(cfg.MaxBodyBytes)
+
+	var ks *jwks.KeySet
+	if cfg.JWKS.Source != "" {
+		ks, err = jwks.New(cfg.JWKS.Source, cfg.JWKS.RefreshInterval, cfg.JWKS.RotationGrace, l)
+		if err != nil {
+			l.Fatal().Err(err).Stack().Msg("failed to load jwks")
+		}
+		defer ks.Close()
+	}
 
 	s := server.NewServer(cfg.Port, l)
+	s.WithAdmin(cfg.AdminPort)
+	s.WithMetrics(m)
+	s.WithHealth(hc)
+	s.WithTracing(cfg.ServiceName)
+	s.WithRequestIdHeader(cfg.RequestIdHeader)
+	s.WithAccessLogSample(cfg.AccessLogSample)
 	s.WithProxs(pxs)
-	s.SetRouter(cfg.TokenSecret)
+	s.WithTranscoder(tc)
+	s.WithRateLimiter(limiter)
+	s.WithTrustedProxies(cfg.TrustedProxies)
+	s.WithShutdown(cfg.Shutdown.PreStopDelay, cfg.Shutdown.DrainTimeout)
+	if cfg.HTTPS.Enabled {
+		minVersion, err := certs.ParseVersion(cfg.HTTPS.MinVersion)
+		if err != nil {
+			l.Fatal().Err(err).Stack().Msg("failed to configure https")
+		}
+		pairs := make([]certs.Pair, len(cfg.HTTPS.CertFiles))
+		for i := range pairs {
+			pairs[i] = certs.Pair{CertFile: cfg.HTTPS.CertFiles[i], KeyFile: cfg.HTTPS.KeyFiles[i]}
+		}
+		rl, err := certs.NewReloader(l, cfg.HTTPS.ReloadInterval, cfg.HTTPS.ClientCAFile, pairs...)
+		if err != nil {
+			l.Fatal().Err(err).Stack().Msg("failed to load https certificates")
+		}
+		defer rl.Close()
+		s.WithTLS(rl.ServerConfig(minVersion)).WithRedirect(cfg.HTTPS.RedirectPort)
+	} else if cfg.HTTPS.H2C {
+		s.WithH2C()
+	}
+	authn := middleware.NewAuthenticator(middleware.Keyfunc(cfg.TokenSecret, ks)).
+		WithRevocation(revoked).
+		WithServices(clientcert.NewMapper(table.Services)).
+		WithAPIKeys(keys)
+	if err := s.SetRouter(authn, table); err != nil {
+		l.Fatal().Err(err).Stack().Msg("failed to set router")
+	}
 	s.Run()
 }
+
+func breakerLogger(l zerolog.Logger, m *metrics.Metrics) func(name, method string, from, to upstream.State) {
+	return func(name, method string, from, to upstream.State) {
+		m.SetBreakerState(name, method, int(to))
+		l.Warn().Str("upstream", name).Str("method", method).
+			Stringer("from", from).Stringer("to", to).
+			Msg("circuit breaker state changed")
+	}
+}
+
+func clientTLS(c config.ClientTLS, l zerolog.Logger) (*certs.Reloader, credentials.TransportCredentials, error) {
+	minVersion, err := certs.ParseVersion(c.MinVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	var pairs []certs.Pair
+	if c.CertFile != "" {
+		pairs = append(pairs, certs.Pair{CertFile: c.CertFile, KeyFile: c.KeyFile})
+	}
+	rl, err := certs.NewReloader(l, c.ReloadInterval, c.CAFile, pairs...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rl, rl.ClientCredentials(c.ServerName, minVersion), nil
+}
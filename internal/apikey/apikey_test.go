@@ -0,0 +1,149 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerate(t *testing.T) {
+	key, k, err := Generate(Key{Owner: "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, secret, err := Parse(key)
+	if err != nil {
+		t.Fatalf("Parse(%q) = %v", key, err)
+	}
+	if id != k.Id || k.Owner != "acme" {
+		t.Errorf("key %+v does not match id %q", k, id)
+	}
+	if k.Hash != hash(secret) || strings.Contains(k.Hash, secret) {
+		t.Error("stored hash does not match the secret")
+	}
+	other, _, err := Generate(Key{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == key {
+		t.Error("Generate returned the same key twice")
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		key        string
+		id, secret string
+		wantErr    bool
+	}{
+		{key: "sgw_0123_abc", id: "0123", secret: "abc"},
+		{key: "sgw_0123_a_b-c", id: "0123", secret: "a_b-c"},
+		{key: "", wantErr: true},
+		{key: "sgw", wantErr: true},
+		{key: "sgw_0123", wantErr: true},
+		{key: "sgw__abc", wantErr: true},
+		{key: "sgw_0123_", wantErr: true},
+		{key: "xyz_0123_abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		id, secret, err := Parse(tt.key)
+		if tt.wantErr {
+			if !errors.Is(err, ErrMalformed) {
+				t.Errorf("Parse(%q) error = %v, want ErrMalformed", tt.key, err)
+			}
+			continue
+		}
+		if err != nil || id != tt.id || secret != tt.secret {
+			t.Errorf("Parse(%q) = %q, %q, %v, want %q, %q", tt.key, id, secret, err, tt.id, tt.secret)
+		}
+	}
+}
+
+type mapStore map[string]Key
+
+func (s mapStore) Create(_ context.Context, k Key) error {
+	s[k.Id] = k
+	return nil
+}
+
+func (s mapStore) Get(_ context.Context, id string) (*Key, error) {
+	k, ok := s[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &k, nil
+}
+
+func (s mapStore) List(context.Context) ([]Key, error) {
+	keys := make([]Key, 0, len(s))
+	for _, k := range s {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func (s mapStore) Revoke(_ context.Context, id string, at time.Time) error {
+	k, ok := s[id]
+	if !ok {
+		return ErrNotFound
+	}
+	k.RevokedAt = &at
+	s[id] = k
+	return nil
+}
+
+func TestVerify(t *testing.T) {
+	key, k, err := Generate(Key{Owner: "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown, _, err := Generate(Key{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := mapStore{k.Id: k}
+	_, secret, _ := Parse(key)
+	tests := []struct {
+		name    string
+		key     string
+		wantErr error
+	}{
+		{name: "valid", key: key},
+		{name: "wrong secret", key: prefix + "_" + k.Id + "_x" + secret, wantErr: ErrMismatch},
+		{name: "unknown id", key: unknown, wantErr: ErrNotFound},
+		{name: "malformed", key: "Bearer " + key, wantErr: ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Verify(context.Background(), store, tt.key)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got.Id != k.Id {
+				t.Errorf("Verify() = %q, want %q", got.Id, k.Id)
+			}
+		})
+	}
+}
+
+func TestExpired(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Second), now.Add(time.Second)
+	tests := []struct {
+		expiresAt *time.Time
+		want      bool
+	}{
+		{expiresAt: nil, want: false},
+		{expiresAt: &past, want: true},
+		{expiresAt: &now, want: true},
+		{expiresAt: &future, want: false},
+	}
+	for _, tt := range tests {
+		k := Key{ExpiresAt: tt.expiresAt}
+		if got := k.Expired(now); got != tt.want {
+			t.Errorf("Expired() with expiresAt %v = %v, want %v", tt.expiresAt, got, tt.want)
+		}
+	}
+}
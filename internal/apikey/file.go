@@ -0,0 +1,220 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// FileStore keeps keys in memory and persists them as a JSON array, replacing
+// the file atomically on every change. The file is re-read when its
+// modification time changes, so replicas sharing it see keys created or
+// revoked elsewhere within interval.
+type FileStore struct {
+	path     string
+	l        zerolog.Logger
+	interval time.Duration
+
+	mu    sync.RWMutex
+	keys  map[string]Key
+	mtime time.Time
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewFileStore loads the keys in path, which may not exist yet, and checks
+// the file for changes every interval.
+func NewFileStore(path string, l zerolog.Logger, interval time.Duration) (*FileStore, error) {
+	s := &FileStore{path: path, l: l, interval: interval, keys: make(map[string]Key), done: make(chan struct{})}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if interval > 0 {
+		s.wg.Add(1)
+		go s.watch()
+	}
+	return s, nil
+}
+
+func (s *FileStore) Close() {
+	close(s.done)
+	s.wg.Wait()
+}
+
+func (s *FileStore) Create(_ context.Context, k Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Pick up changes made by other replicas so that saving keeps them.
+	if err := s.reload(); err != nil {
+		return err
+	}
+	if _, ok := s.keys[k.Id]; ok {
+		return errors.Errorf("api key %s already exists", k.Id)
+	}
+	s.keys[k.Id] = k
+	if err := s.save(); err != nil {
+		delete(s.keys, k.Id)
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) Get(_ context.Context, id string) (*Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	k, ok := s.keys[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &k, nil
+}
+
+// List returns all keys, newest first.
+func (s *FileStore) List(_ context.Context) ([]Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sorted(), nil
+}
+
+func (s *FileStore) Revoke(_ context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return err
+	}
+	k, ok := s.keys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if k.RevokedAt != nil {
+		return nil
+	}
+	prev := k
+	k.RevokedAt = &at
+	s.keys[id] = k
+	if err := s.save(); err != nil {
+		s.keys[id] = prev
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) watch() {
+	defer s.wg.Done()
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+		}
+		s.mu.RLock()
+		changed := s.changed()
+		s.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		s.mu.Lock()
+		err := s.reload()
+		s.mu.Unlock()
+		if err != nil {
+			s.l.Error().Err(err).Msg("failed to reload api keys, keeping the previous ones")
+			continue
+		}
+		s.l.Info().Msg("api keys reloaded")
+	}
+}
+
+// changed reports whether the file was modified since it was last read or
+// written. The caller must hold mu.
+func (s *FileStore) changed() bool {
+	st, err := os.Stat(s.path)
+	if err != nil {
+		return false
+	}
+	return !st.ModTime().Equal(s.mtime)
+}
+
+// reload loads the file if it changed. The caller must hold mu for writing.
+func (s *FileStore) reload() error {
+	if !s.changed() {
+		return nil
+	}
+	return s.load()
+}
+
+// load replaces the keys with the contents of the file. The caller must hold
+// mu for writing, except in NewFileStore.
+func (s *FileStore) load() error {
+	st, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to read api keys file")
+	}
+	b, err := os.ReadFile(s.path)
+	if err != nil {
+		return errors.Wrap(err, "failed to read api keys file")
+	}
+	var list []Key
+	if err := json.Unmarshal(b, &list); err != nil {
+		return errors.Wrap(err, "failed to parse api keys file")
+	}
+	keys := make(map[string]Key, len(list))
+	for _, k := range list {
+		keys[k.Id] = k
+	}
+	s.keys, s.mtime = keys, st.ModTime()
+	return nil
+}
+
+func (s *FileStore) sorted() []Key {
+	keys := make([]Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+	return keys
+}
+
+func (s *FileStore) save() error {
+	b, err := json.MarshalIndent(s.sorted(), "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to encode api keys")
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return errors.Wrap(err, "failed to write api keys file")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "failed to write api keys file")
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "failed to write api keys file")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "failed to write api keys file")
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return errors.Wrap(err, "failed to write api keys file")
+	}
+	if st, err := os.Stat(s.path); err == nil {
+		s.mtime = st.ModTime()
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func newFileStore(t *testing.T, path string) *FileStore {
+	t.Helper()
+	s, err := NewFileStore(path, zerolog.Nop(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// touch moves the modification time of path forward so that a change is
+// detected even on file systems with coarse timestamps.
+func touch(t *testing.T, path string) {
+	t.Helper()
+	at := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, at, at); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	s := newFileStore(t, path)
+	if keys, _ := s.List(ctx); len(keys) != 0 {
+		t.Fatalf("List() on a missing file = %v", keys)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	older := Key{Id: "a", Owner: "acme", CreatedAt: now.Add(-time.Hour)}
+	newer := Key{Id: "b", Owner: "initech", CreatedAt: now}
+	for _, k := range []Key{older, newer} {
+		if err := s.Create(ctx, k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Create(ctx, older); err == nil {
+		t.Error("Create() accepted a duplicate id")
+	}
+	if err := s.Revoke(ctx, "a", now); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Revoke(ctx, "missing", now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Revoke() of a missing key = %v, want ErrNotFound", err)
+	}
+	if _, err := s.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of a missing key = %v, want ErrNotFound", err)
+	}
+
+	reopened := newFileStore(t, path)
+	keys, err := reopened.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].Id != "b" || keys[1].Id != "a" {
+		t.Fatalf("List() = %+v, want b then a", keys)
+	}
+	if !keys[1].Revoked() || keys[0].Revoked() {
+		t.Error("revocation was not persisted")
+	}
+}
+
+func TestFileStoreSeesOtherReplicas(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	a := newFileStore(t, path)
+	b := newFileStore(t, path)
+
+	if err := a.Create(ctx, Key{Id: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, path)
+	// Writes merge changes made elsewhere instead of overwriting them.
+	if err := b.Create(ctx, Key{Id: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, path)
+	if err := a.Revoke(ctx, "b", time.Now()); err != nil {
+		t.Fatalf("Revoke() of a key created by another replica = %v", err)
+	}
+	touch(t, path)
+
+	s, err := NewFileStore(path, zerolog.Nop(), 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if k, err := s.Get(ctx, "b"); err != nil || !k.Revoked() {
+		t.Fatalf("Get(b) = %+v, %v, want a revoked key", k, err)
+	}
+	if err := b.Create(ctx, Key{Id: "c"}); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, path)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := s.Get(ctx, "c"); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("key created by another replica was not picked up")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestFileStoreKeepsKeysOnBadReload(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	s := newFileStore(t, path)
+	if err := s.Create(ctx, Key{Id: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, path)
+	if err := s.Create(ctx, Key{Id: "b"}); err == nil {
+		t.Error("Create() overwrote an unreadable keys file")
+	}
+	if _, err := s.Get(ctx, "a"); err != nil {
+		t.Errorf("Get() after a failed reload = %v", err)
+	}
+}
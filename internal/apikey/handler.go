@@ -0,0 +1,191 @@
+package apikey
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/vindosVP/snapigw/internal/utils/response"
+)
+
+type CreateRequest struct {
+	Owner     string     `json:"owner" validate:"required"`
+	Scopes    []string   `json:"scopes"`
+	Tier      string     `json:"tier"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// View is a key as shown to administrators, without its hash.
+type View struct {
+	Id        string     `json:"id"`
+	Owner     string     `json:"owner"`
+	Scopes    []string   `json:"scopes"`
+	Tier      string     `json:"tier,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+type CreateResponse struct {
+	View
+	// Key is the full API key. It can not be retrieved again.
+	Key string `json:"key" log:"redact"`
+}
+
+func view(k Key) View {
+	return View{
+		Id:        k.Id,
+		Owner:     k.Owner,
+		Scopes:    k.Scopes,
+		Tier:      k.Tier,
+		CreatedAt: k.CreatedAt,
+		ExpiresAt: k.ExpiresAt,
+		RevokedAt: k.RevokedAt,
+	}
+}
+
+// Admin serves the endpoints that manage API keys.
+type Admin struct {
+	store       Store
+	l           zerolog.Logger
+	tiers       map[string]struct{}
+	defaultTier string
+	scopes      []string
+}
+
+func NewAdmin(store Store, l zerolog.Logger) *Admin {
+	return &Admin{store: store, l: l}
+}
+
+// WithTiers restricts new keys to the given rate limit tiers.
+func (a *Admin) WithTiers(tiers []string) *Admin {
+	a.tiers = make(map[string]struct{}, len(tiers))
+	for _, t := range tiers {
+		a.tiers[t] = struct{}{}
+	}
+	return a
+}
+
+// WithDefaultTier assigns tier to keys created without one.
+func (a *Admin) WithDefaultTier(tier string) *Admin {
+	a.defaultTier = tier
+	return a
+}
+
+// WithScopes lets callers grant the given scopes to new keys. Any other scope
+// can only be granted by a caller that holds it.
+func (a *Admin) WithScopes(scopes []string) *Admin {
+	a.scopes = scopes
+	return a
+}
+
+func (a *Admin) Handlers() map[string]gin.HandlerFunc {
+	return map[string]gin.HandlerFunc{
+		"create": a.CreateHandler(),
+		"list":   a.ListHandler(),
+		"revoke": a.RevokeHandler(),
+	}
+}
+
+func (a *Admin) CreateHandler() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		lg := a.l.With().Ctx(c).Str("requestId", c.GetString("requestId")).Logger()
+		req := &CreateRequest{}
+		if err := c.BindJSON(req); err != nil {
+			lg.Info().Msg("invalid request structure")
+			response.Err(c, http.StatusBadRequest, "invalid request structure")
+			return
+		}
+		if err := validator.New().Struct(req); err != nil {
+			lg.Info().Msg("invalid request")
+			response.Err(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if req.Tier == "" {
+			req.Tier = a.defaultTier
+		}
+		if req.Tier == "" && len(a.tiers) > 0 {
+			response.Err(c, http.StatusBadRequest, "tier is required")
+			return
+		}
+		if _, ok := a.tiers[req.Tier]; req.Tier != "" && !ok {
+			response.Err(c, http.StatusBadRequest, "unknown tier")
+			return
+		}
+		held := c.GetStringSlice("scopes")
+		for _, s := range req.Scopes {
+			if !slices.Contains(held, s) && !slices.Contains(a.scopes, s) {
+				lg.Info().Str("scope", s).Msg("caller may not grant scope")
+				response.Err(c, http.StatusForbidden, "scope "+s+" can not be granted")
+				return
+			}
+		}
+		now := time.Now().UTC()
+		if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+			response.Err(c, http.StatusBadRequest, "expiresAt must be in the future")
+			return
+		}
+		key, k, err := Generate(Key{
+			Owner:     req.Owner,
+			Scopes:    req.Scopes,
+			Tier:      req.Tier,
+			CreatedAt: now,
+			ExpiresAt: req.ExpiresAt,
+		})
+		if err != nil {
+			lg.Error().Err(err).Stack().Msg("failed to generate api key")
+			response.Err(c, http.StatusInternalServerError, "failed to create api key")
+			return
+		}
+		if err := a.store.Create(c, k); err != nil {
+			lg.Error().Err(err).Stack().Msg("failed to store api key")
+			response.Err(c, http.StatusInternalServerError, "failed to create api key")
+			return
+		}
+		lg.Info().Str("apiKeyId", k.Id).Str("owner", k.Owner).Msg("api key created")
+		response.OkMsg(c, http.StatusCreated, &CreateResponse{View: view(k), Key: key}, "api key created")
+	}
+}
+
+func (a *Admin) ListHandler() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		keys, err := a.store.List(c)
+		if err != nil {
+			a.l.Error().Err(err).Str("requestId", c.GetString("requestId")).Msg("failed to list api keys")
+			response.Err(c, http.StatusInternalServerError, "failed to list api keys")
+			return
+		}
+		owner := c.Query("owner")
+		views := make([]View, 0, len(keys))
+		for _, k := range keys {
+			if owner == "" || k.Owner == owner {
+				views = append(views, view(k))
+			}
+		}
+		response.Ok(c, http.StatusOK, views)
+	}
+}
+
+func (a *Admin) RevokeHandler() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		lg := a.l.With().Ctx(c).Str("requestId", c.GetString("requestId")).Logger()
+		id := c.Param("id")
+		err := a.store.Revoke(c, id, time.Now().UTC())
+		if errors.Is(err, ErrNotFound) {
+			response.Err(c, http.StatusNotFound, "api key not found")
+			return
+		}
+		if err != nil {
+			lg.Error().Err(err).Stack().Msg("failed to revoke api key")
+			response.Err(c, http.StatusInternalServerError, "failed to revoke api key")
+			return
+		}
+		lg.Info().Str("apiKeyId", id).Msg("api key revoked")
+		response.OkMsg(c, http.StatusOK, nil, "api key revoked")
+	}
+}
@@ -0,0 +1,121 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+func TestCreateHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name        string
+		body        string
+		held        []string
+		defaultTier string
+		want        int
+		wantTier    string
+	}{
+		{name: "explicit tier", body: `{"owner":"acme","tier":"partner"}`, defaultTier: "standard", want: http.StatusCreated, wantTier: "partner"},
+		{name: "default tier", body: `{"owner":"acme"}`, defaultTier: "standard", want: http.StatusCreated, wantTier: "standard"},
+		{name: "tier required without a default", body: `{"owner":"acme"}`, want: http.StatusBadRequest},
+		{name: "unknown tier", body: `{"owner":"acme","tier":"gold"}`, defaultTier: "standard", want: http.StatusBadRequest},
+		{name: "allow-listed scope", body: `{"owner":"acme","scopes":["users:ban"]}`, defaultTier: "standard", want: http.StatusCreated, wantTier: "standard"},
+		{name: "scope held by the caller", body: `{"owner":"acme","scopes":["audit:read"]}`, held: []string{"audit:read"}, defaultTier: "standard", want: http.StatusCreated, wantTier: "standard"},
+		{name: "scope not held by the caller", body: `{"owner":"acme","scopes":["users:ban","users:admin"]}`, held: []string{"audit:read"}, defaultTier: "standard", want: http.StatusForbidden},
+		{name: "missing owner", body: `{"tier":"standard"}`, defaultTier: "standard", want: http.StatusBadRequest},
+		{name: "past expiry", body: `{"owner":"acme","expiresAt":"2000-01-01T00:00:00Z"}`, defaultTier: "standard", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := mapStore{}
+			a := NewAdmin(store, zerolog.Nop()).
+				WithTiers([]string{"standard", "partner"}).
+				WithDefaultTier(tt.defaultTier).
+				WithScopes([]string{"users:ban"})
+			r := gin.New()
+			r.POST("/", func(c *gin.Context) {
+				c.Set("scopes", tt.held)
+			}, a.CreateHandler())
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body)))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d (%s), want %d", w.Code, w.Body, tt.want)
+			}
+			if tt.want != http.StatusCreated {
+				if len(store) != 0 {
+					t.Errorf("rejected request stored %v", store)
+				}
+				return
+			}
+			var res struct {
+				Data CreateResponse `json:"data"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Data.Tier != tt.wantTier {
+				t.Errorf("tier = %q, want %q", res.Data.Tier, tt.wantTier)
+			}
+			k, err := Verify(context.Background(), store, res.Data.Key)
+			if err != nil {
+				t.Fatalf("created key does not verify: %v", err)
+			}
+			if k.Tier != tt.wantTier || k.Owner != "acme" {
+				t.Errorf("stored key = %+v", k)
+			}
+		})
+	}
+}
+
+func TestListAndRevokeHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := mapStore{
+		"a": {Id: "a", Owner: "acme", Hash: "secret"},
+		"b": {Id: "b", Owner: "initech", Hash: "secret"},
+	}
+	a := NewAdmin(store, zerolog.Nop())
+	r := gin.New()
+	r.GET("/", a.ListHandler())
+	r.DELETE("/:id", a.RevokeHandler())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?owner=acme", nil))
+	if strings.Contains(w.Body.String(), "secret") {
+		t.Error("list exposes key hashes")
+	}
+	var res struct {
+		Data []View `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Data) != 1 || res.Data[0].Id != "a" {
+		t.Errorf("list filtered by owner = %+v", res.Data)
+	}
+
+	tests := []struct {
+		id   string
+		want int
+	}{
+		{id: "a", want: http.StatusOK},
+		{id: "a", want: http.StatusOK},
+		{id: "missing", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/"+tt.id, nil))
+		if w.Code != tt.want {
+			t.Errorf("revoke %s: status = %d, want %d", tt.id, w.Code, tt.want)
+		}
+	}
+	if store["a"].RevokedAt == nil || store["b"].RevokedAt != nil {
+		t.Error("revoke changed the wrong keys")
+	}
+}
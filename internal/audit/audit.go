@@ -0,0 +1,162 @@
+package audit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Entry describes one administrative action.
+type Entry struct {
+	Time      time.Time   `json:"time"`
+	ActorId   string      `json:"actorId"`
+	TargetId  string      `json:"targetId"`
+	Action    string      `json:"action"`
+	NewValue  interface{} `json:"newValue,omitempty"`
+	RequestId string      `json:"requestId"`
+	ClientIP  string      `json:"clientIp"`
+	Outcome   string      `json:"outcome"`
+	Error     string      `json:"error,omitempty"`
+}
+
+type Sink interface {
+	Write(ctx context.Context, e Entry) error
+}
+
+type Filter struct {
+	ActorId  string
+	TargetId string
+	Limit    int
+}
+
+type queued struct {
+	ctx context.Context
+	e   Entry
+}
+
+// Auditor writes entries to every sink and keeps the most recent ones in
+// memory to answer queries. Sinks are written by a background worker so that
+// a slow webhook does not hold up the request being audited.
+type Auditor struct {
+	l      zerolog.Logger
+	sinks  []Sink
+	mu     sync.RWMutex
+	recent []Entry
+	size   int
+	next   int
+	full   bool
+	queue  chan queued
+	closed bool
+	done   chan struct{}
+}
+
+// New buffers up to queue entries waiting for the sinks and keeps the last
+// size entries in memory.
+func New(l zerolog.Logger, size, queue int, sinks ...Sink) *Auditor {
+	a := &Auditor{
+		l:      l,
+		sinks:  sinks,
+		recent: make([]Entry, size),
+		size:   size,
+		queue:  make(chan queued, queue),
+		done:   make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// Close writes the queued entries and stops the worker.
+func (a *Auditor) Close() {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+	<-a.done
+}
+
+func (a *Auditor) run() {
+	defer close(a.done)
+	for q := range a.queue {
+		for _, s := range a.sinks {
+			if err := s.Write(q.ctx, q.e); err != nil {
+				a.l.Error().Err(err).Str("action", q.e.Action).Str("requestId", q.e.RequestId).Msg("failed to write audit entry")
+			}
+		}
+	}
+}
+
+// Preload seeds the in-memory history, e.g. with the tail of the audit file.
+func (a *Auditor) Preload(entries []Entry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, e := range entries {
+		a.push(e)
+	}
+}
+
+// Record queues e for all sinks without waiting for them. When the queue is
+// full the entry is logged instead, so the action still leaves a trace.
+func (a *Auditor) Record(ctx context.Context, e Entry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.push(e)
+	if a.closed {
+		a.l.Error().Interface("entry", e).Msg("audit entry recorded after close")
+		return
+	}
+	select {
+	case a.queue <- queued{ctx: context.WithoutCancel(ctx), e: e}:
+	default:
+		a.l.Error().Interface("entry", e).Msg("audit queue is full, entry not written to sinks")
+	}
+}
+
+// Recent returns matching entries, newest first.
+func (a *Auditor) Recent(f Filter) []Entry {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	out := make([]Entry, 0)
+	a.each(func(e Entry) bool {
+		if (f.ActorId == "" || e.ActorId == f.ActorId) && (f.TargetId == "" || e.TargetId == f.TargetId) {
+			out = append(out, e)
+		}
+		return f.Limit <= 0 || len(out) < f.Limit
+	})
+	return out
+}
+
+func (a *Auditor) push(e Entry) {
+	if a.size == 0 {
+		return
+	}
+	a.recent[a.next] = e
+	a.next = (a.next + 1) % a.size
+	if a.next == 0 {
+		a.full = true
+	}
+}
+
+// each visits buffered entries from newest to oldest until fn returns false.
+func (a *Auditor) each(fn func(Entry) bool) {
+	n := a.next
+	if a.full {
+		n = a.size
+	}
+	for i := 1; i <= n; i++ {
+		if !fn(a.recent[(a.next-i+a.size)%a.size]) {
+			return
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+type memorySink struct {
+	mu      sync.Mutex
+	entries []Entry
+	block   chan struct{}
+}
+
+func (s *memorySink) Write(_ context.Context, e Entry) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, e)
+	return nil
+}
+
+func TestRecordWritesSinksInBackground(t *testing.T) {
+	sink := &memorySink{block: make(chan struct{})}
+	a := New(zerolog.Nop(), 10, 10, sink)
+	ctx, cancel := context.WithCancel(context.Background())
+	a.Record(ctx, Entry{TargetId: "1", Action: "user.setBanned", NewValue: true, Outcome: OutcomeSuccess})
+	a.Record(ctx, Entry{TargetId: "1", Action: "user.setBanned", NewValue: false, Outcome: OutcomeSuccess})
+	// The request is over before the sink gets to the entries.
+	cancel()
+	close(sink.block)
+	a.Close()
+
+	if len(sink.entries) != 2 {
+		t.Fatalf("sink entries = %d, want 2", len(sink.entries))
+	}
+	for _, e := range sink.entries {
+		if e.Time.IsZero() {
+			t.Error("entry time is not set")
+		}
+	}
+}
+
+func TestRecordDoesNotBlockOnAFullQueue(t *testing.T) {
+	sink := &memorySink{block: make(chan struct{})}
+	a := New(zerolog.Nop(), 10, 1, sink)
+	for i := 0; i < 5; i++ {
+		a.Record(context.Background(), Entry{Action: "a"})
+	}
+	close(sink.block)
+	a.Close()
+	// One entry is being written while one waits; the rest are dropped.
+	if n := len(sink.entries); n < 1 || n > 2 {
+		t.Errorf("sink entries = %d, want 1 or 2", n)
+	}
+	if n := len(a.Recent(Filter{})); n != 5 {
+		t.Errorf("recent entries = %d, want 5", n)
+	}
+	a.Record(context.Background(), Entry{Action: "after close"})
+}
+
+func TestRecent(t *testing.T) {
+	a := New(zerolog.Nop(), 3, 10)
+	defer a.Close()
+	a.Preload([]Entry{
+		{ActorId: "1", TargetId: "a", Action: "0"},
+		{ActorId: "1", TargetId: "b", Action: "1"},
+	})
+	for _, e := range []Entry{
+		{ActorId: "2", TargetId: "a", Action: "2"},
+		{ActorId: "1", TargetId: "a", Action: "3"},
+	} {
+		a.Record(context.Background(), e)
+	}
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{name: "all, newest first, oldest evicted", filter: Filter{}, want: []string{"3", "2", "1"}},
+		{name: "by actor", filter: Filter{ActorId: "1"}, want: []string{"3", "1"}},
+		{name: "by target", filter: Filter{TargetId: "a"}, want: []string{"3", "2"}},
+		{name: "by actor and target", filter: Filter{ActorId: "2", TargetId: "a"}, want: []string{"2"}},
+		{name: "limit", filter: Filter{Limit: 2}, want: []string{"3", "2"}},
+		{name: "no match", filter: Filter{ActorId: "3"}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := a.Recent(tt.filter)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d entries, want %v", len(got), tt.want)
+			}
+			for i, e := range got {
+				if e.Action != tt.want[i] {
+					t.Errorf("entry %d = %s, want %s", i, e.Action, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestListHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	a := New(zerolog.Nop(), 10, 10)
+	defer a.Close()
+	r := gin.New()
+	r.GET("/", a.ListHandler())
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{query: "", want: http.StatusOK},
+		{query: "?limit=5&actor=1&target=2", want: http.StatusOK},
+		{query: "?limit=0", want: http.StatusBadRequest},
+		{query: "?limit=x", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+tt.query, nil))
+		if w.Code != tt.want {
+			t.Errorf("GET %s: status = %d, want %d", tt.query, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// FileSink appends entries to a JSON Lines file.
+type FileSink struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open audit file")
+	}
+	return &FileSink{path: path, f: f}, nil
+}
+
+func (s *FileSink) Write(_ context.Context, e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal audit entry")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.f.Write(append(b, '\n')); err != nil {
+		return errors.Wrap(err, "failed to write audit entry")
+	}
+	return s.f.Sync()
+}
+
+// Tail returns up to n of the last entries in the file, oldest first.
+func (s *FileSink) Tail(n int) ([]Entry, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open audit file")
+	}
+	defer f.Close()
+	var entries []Entry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for sc.Scan() {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+		if len(entries) > n {
+			entries = entries[1:]
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read audit file")
+	}
+	return entries, nil
+}
+
+func (s *FileSink) Close() error {
+	return s.f.Close()
+}
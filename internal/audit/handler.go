@@ -0,0 +1,38 @@
+package audit
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/vindosVP/snapigw/internal/utils/response"
+)
+
+const defaultLimit = 100
+
+func (a *Auditor) Handlers() map[string]gin.HandlerFunc {
+	return map[string]gin.HandlerFunc{
+		"list": a.ListHandler(),
+	}
+}
+
+func (a *Auditor) ListHandler() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		limit := defaultLimit
+		if v := c.Query("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				response.Err(c, http.StatusBadRequest, "invalid limit")
+				return
+			}
+			limit = n
+		}
+		entries := a.Recent(Filter{
+			ActorId:  c.Query("actor"),
+			TargetId: c.Query("target"),
+			Limit:    limit,
+		})
+		response.Ok(c, http.StatusOK, entries)
+	}
+}
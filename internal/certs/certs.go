@@ -0,0 +1,170 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// Pair names the PEM files of a certificate chain and its private key.
+type Pair struct {
+	CertFile string
+	KeyFile  string
+}
+
+// Reloader holds certificates and a CA bundle read from files and re-reads
+// them whenever a file's modification time changes. A failed reload keeps
+// the previous material so that a half-written file does not break TLS.
+type Reloader struct {
+	l        zerolog.Logger
+	pairs    []Pair
+	caFile   string
+	interval time.Duration
+
+	mu     sync.RWMutex
+	certs  []*tls.Certificate
+	pool   *x509.CertPool
+	mtimes map[string]time.Time
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewReloader loads caFile, which may be empty, and every pair, failing if
+// any of them is invalid. Files are checked for changes every interval.
+func NewReloader(l zerolog.Logger, interval time.Duration, caFile string, pairs ...Pair) (*Reloader, error) {
+	r := &Reloader{
+		l:        l,
+		pairs:    pairs,
+		caFile:   caFile,
+		interval: interval,
+		mtimes:   make(map[string]time.Time),
+		done:     make(chan struct{}),
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	if interval > 0 {
+		r.wg.Add(1)
+		go r.watch()
+	}
+	return r, nil
+}
+
+func (r *Reloader) Close() {
+	close(r.done)
+	r.wg.Wait()
+}
+
+// Certificates returns the loaded certificates in the order of their pairs.
+func (r *Reloader) Certificates() []*tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.certs
+}
+
+// Pool returns the CA bundle, or nil when no CA file is configured.
+func (r *Reloader) Pool() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pool
+}
+
+func (r *Reloader) watch() {
+	defer r.wg.Done()
+	t := time.NewTicker(r.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-t.C:
+		}
+		if !r.changed() {
+			continue
+		}
+		if err := r.load(); err != nil {
+			r.l.Error().Err(err).Msg("failed to reload certificates, keeping the previous ones")
+			continue
+		}
+		r.l.Info().Msg("certificates reloaded")
+	}
+}
+
+func (r *Reloader) files() []string {
+	var files []string
+	if r.caFile != "" {
+		files = append(files, r.caFile)
+	}
+	for _, p := range r.pairs {
+		files = append(files, p.CertFile, p.KeyFile)
+	}
+	return files
+}
+
+func (r *Reloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, f := range r.files() {
+		st, err := os.Stat(f)
+		if err != nil {
+			// Files are often replaced by rename; try again on the next tick.
+			continue
+		}
+		if !st.ModTime().Equal(r.mtimes[f]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reloader) load() error {
+	mtimes := make(map[string]time.Time)
+	for _, f := range r.files() {
+		st, err := os.Stat(f)
+		if err != nil {
+			return errors.Wrap(err, "failed to stat certificate file")
+		}
+		mtimes[f] = st.ModTime()
+	}
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		b, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to read ca file")
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return fmt.Errorf("no certificates found in %s", r.caFile)
+		}
+	}
+	certs := make([]*tls.Certificate, 0, len(r.pairs))
+	for _, p := range r.pairs {
+		c, err := tls.LoadX509KeyPair(p.CertFile, p.KeyFile)
+		if err != nil {
+			return errors.Wrapf(err, "failed to load key pair %s", p.CertFile)
+		}
+		certs = append(certs, &c)
+	}
+	r.mu.Lock()
+	r.pool, r.certs, r.mtimes = pool, certs, mtimes
+	r.mu.Unlock()
+	return nil
+}
+
+// ParseVersion maps "1.2" and "1.3" to their tls constants.
+func ParseVersion(v string) (uint16, error) {
+	switch v {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported tls version %q", v)
+}
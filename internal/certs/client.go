@@ -0,0 +1,88 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/credentials"
+)
+
+// ClientConfig returns a client TLS config that presents the first loaded
+// certificate, if any, and verifies servers against the reloadable CA bundle
+// or the system roots when no CA file is configured. The server certificate
+// must be valid for serverName, which may be a host name or an IP address.
+func (r *Reloader) ClientConfig(serverName string, minVersion uint16) *tls.Config {
+	return &tls.Config{
+		MinVersion: minVersion,
+		ServerName: serverName,
+		// RootCAs can not change after the handshake starts, so the chain is
+		// verified in VerifyConnection against the current pool instead.
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			return r.verifyServer(cs, serverName)
+		},
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if certs := r.Certificates(); len(certs) > 0 {
+				return certs[0], nil
+			}
+			return &tls.Certificate{}, nil
+		},
+	}
+}
+
+// ClientCredentials returns gRPC transport credentials built on ClientConfig.
+// Servers are verified against serverName or, when it is empty, against the
+// host of the address being dialled.
+func (r *Reloader) ClientCredentials(serverName string, minVersion uint16) credentials.TransportCredentials {
+	return &clientCredentials{
+		TransportCredentials: credentials.NewTLS(r.ClientConfig(serverName, minVersion)),
+		r:                    r,
+		serverName:           serverName,
+		minVersion:           minVersion,
+	}
+}
+
+type clientCredentials struct {
+	credentials.TransportCredentials
+	r          *Reloader
+	serverName string
+	minVersion uint16
+}
+
+func (c *clientCredentials) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	name := c.serverName
+	if name == "" {
+		name = authority
+		if host, _, err := net.SplitHostPort(authority); err == nil {
+			name = host
+		}
+	}
+	return credentials.NewTLS(c.r.ClientConfig(name, c.minVersion)).ClientHandshake(ctx, authority, conn)
+}
+
+func (c *clientCredentials) Clone() credentials.TransportCredentials {
+	return c.r.ClientCredentials(c.serverName, c.minVersion)
+}
+
+func (r *Reloader) verifyServer(cs tls.ConnectionState, serverName string) error {
+	if serverName == "" {
+		return errors.New("no server name to verify the certificate against")
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("server presented no certificate")
+	}
+	// DNSName also matches IP addresses against the IP SANs.
+	opts := x509.VerifyOptions{
+		Roots:         r.Pool(),
+		DNSName:       serverName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, c := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
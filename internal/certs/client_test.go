@@ -0,0 +1,203 @@
+package certs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type issuer struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newCA(t *testing.T) issuer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return issuer{cert: cert, key: key}
+}
+
+// writePEM writes the CA certificate to dir and returns its path.
+func (ca issuer) writePEM(t *testing.T, dir string) string {
+	t.Helper()
+	path := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// issue writes a server certificate for the given DNS names and IPs to dir.
+func (ca issuer) issue(t *testing.T, dir string, dns []string, ips []net.IP) Pair {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "server"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     dns,
+		IPAddresses:  ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Pair{CertFile: filepath.Join(dir, "server.pem"), KeyFile: filepath.Join(dir, "server-key.pem")}
+	if err := os.WriteFile(p.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// handshake runs client against a TLS server on a loopback socket and
+// returns the errors of both sides. A socket rather than net.Pipe, since
+// the server may still be flushing session tickets or an alert when the
+// client is done.
+func handshake(t *testing.T, server *tls.Config, client func(net.Conn) error) (error, error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	errs := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer conn.Close()
+		errs <- tls.Server(conn, server).Handshake()
+	}()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientErr := client(conn)
+	conn.Close()
+	return clientErr, <-errs
+}
+
+func newReloaders(t *testing.T, trusted bool) (server, client *Reloader) {
+	t.Helper()
+	dir := t.TempDir()
+	ca := newCA(t)
+	pair := ca.issue(t, dir, []string{"auth.internal"}, []net.IP{net.ParseIP("10.0.0.1")})
+	if !trusted {
+		ca = newCA(t)
+	}
+	server, err := NewReloader(zerolog.Nop(), 0, "", pair)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err = NewReloader(zerolog.Nop(), 0, ca.writePEM(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, client
+}
+
+func TestClientConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		serverName string
+		untrusted  bool
+		wantErr    bool
+	}{
+		{name: "host name", serverName: "auth.internal"},
+		{name: "ip san", serverName: "10.0.0.1"},
+		{name: "other host name", serverName: "billing.internal", wantErr: true},
+		{name: "other ip", serverName: "10.0.0.2", wantErr: true},
+		{name: "no server name", serverName: "", wantErr: true},
+		{name: "untrusted ca", serverName: "auth.internal", untrusted: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := newReloaders(t, !tt.untrusted)
+			err, _ := handshake(t, server.ServerConfig(tls.VersionTLS12), func(conn net.Conn) error {
+				return tls.Client(conn, client.ClientConfig(tt.serverName, tls.VersionTLS12)).Handshake()
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("handshake error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClientCredentials(t *testing.T) {
+	tests := []struct {
+		name       string
+		serverName string
+		authority  string
+		wantErr    bool
+	}{
+		{name: "host of the dialled address", authority: "auth.internal:443"},
+		{name: "ip of the dialled address", authority: "10.0.0.1:443"},
+		{name: "ip not in the certificate", authority: "10.0.0.2:443", wantErr: true},
+		{name: "override wins over the address", serverName: "auth.internal", authority: "10.0.0.2:443"},
+		{name: "override not in the certificate", serverName: "billing.internal", authority: "10.0.0.1:443", wantErr: true},
+		{name: "empty authority", authority: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := newReloaders(t, true)
+			cfg := server.ServerConfig(tls.VersionTLS12)
+			cfg.NextProtos = []string{"h2"}
+			creds := client.ClientCredentials(tt.serverName, tls.VersionTLS12).Clone()
+			err, _ := handshake(t, cfg, func(conn net.Conn) error {
+				_, _, err := creds.ClientHandshake(context.Background(), tt.authority, conn)
+				return err
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("handshake error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
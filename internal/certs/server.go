@@ -0,0 +1,55 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+)
+
+// ServerConfig returns a server TLS config that picks, by SNI, the first
+// loaded certificate valid for the requested name and falls back to the
+// first certificate otherwise. With a CA file, client certificates are
+// requested and, when presented, must chain to it.
+func (r *Reloader) ServerConfig(minVersion uint16) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: r.getCertificate,
+	}
+	if r.caFile != "" {
+		// ClientCAs can not be swapped on a live config, so the chain is
+		// verified in VerifyConnection against the current pool instead.
+		cfg.ClientAuth = tls.RequestClientCert
+		cfg.VerifyConnection = r.verifyClient
+	}
+	return cfg
+}
+
+func (r *Reloader) verifyClient(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return nil
+	}
+	opts := x509.VerifyOptions{
+		Roots:         r.Pool(),
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, c := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+func (r *Reloader) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certs := r.Certificates()
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate configured")
+	}
+	for _, c := range certs {
+		if hello.SupportsCertificate(c) == nil {
+			return c, nil
+		}
+	}
+	return certs[0], nil
+}
@@ -0,0 +1,99 @@
+package certs
+
+import (
+	"crypto/tls"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestServerConfigSelectsBySNI(t *testing.T) {
+	ca := newCA(t)
+	pairs := make([]Pair, 0, 2)
+	for _, name := range []string{"api.example.com", "admin.example.com"} {
+		dir := filepath.Join(t.TempDir(), name)
+		if err := os.Mkdir(dir, 0o700); err != nil {
+			t.Fatal(err)
+		}
+		pairs = append(pairs, ca.issue(t, dir, []string{name}, nil))
+	}
+	server, err := NewReloader(zerolog.Nop(), 0, "", pairs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewReloader(zerolog.Nop(), 0, ca.writePEM(t, t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		serverName string
+		want       string
+	}{
+		{serverName: "api.example.com", want: "api.example.com"},
+		{serverName: "admin.example.com", want: "admin.example.com"},
+		// Unknown names get the first certificate, which the client rejects.
+		{serverName: "other.example.com", want: "api.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.serverName, func(t *testing.T) {
+			cfg := client.ClientConfig(tt.serverName, tls.VersionTLS12)
+			var got string
+			cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+				got = cs.PeerCertificates[0].DNSNames[0]
+				return client.verifyServer(cs, tt.serverName)
+			}
+			err, _ := handshake(t, server.ServerConfig(tls.VersionTLS12), func(conn net.Conn) error {
+				return tls.Client(conn, cfg).Handshake()
+			})
+			if got != tt.want {
+				t.Errorf("served certificate for %q, want %q", got, tt.want)
+			}
+			if (err == nil) != (tt.serverName == tt.want) {
+				t.Errorf("handshake error = %v", err)
+			}
+		})
+	}
+}
+
+func TestServerConfigVerifiesClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t)
+	serverPair := ca.issue(t, dir, []string{"auth.internal"}, nil)
+	server, err := NewReloader(zerolog.Nop(), 0, ca.writePEM(t, dir), serverPair)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewReloader(zerolog.Nop(), 0, ca.writePEM(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A certificate from another CA is rejected; none at all is left to the
+	// routes that require one.
+	other := newCA(t)
+	otherDir := t.TempDir()
+	stranger, err := NewReloader(zerolog.Nop(), 0, ca.writePEM(t, otherDir), other.issue(t, otherDir, []string{"client"}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		client  *Reloader
+		wantErr bool
+	}{
+		{name: "no certificate", client: client},
+		{name: "untrusted certificate", client: stranger, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := handshake(t, server.ServerConfig(tls.VersionTLS12), func(conn net.Conn) error {
+				return tls.Client(conn, tt.client.ClientConfig("auth.internal", tls.VersionTLS12)).Handshake()
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("server handshake error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package clientcert
+
+import (
+	"crypto/x509"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// Service is a machine identity authenticated by a client certificate. A
+// certificate belongs to the service when one of its URI SANs, DNS SANs or
+// its subject common name is listed.
+type Service struct {
+	URIs        []string `yaml:"uris"`
+	DNSNames    []string `yaml:"dnsNames"`
+	CommonNames []string `yaml:"commonNames"`
+	Roles       []string `yaml:"roles"`
+	Scopes      []string `yaml:"scopes"`
+}
+
+func (s Service) Validate() error {
+	if len(s.URIs)+len(s.DNSNames)+len(s.CommonNames) == 0 {
+		return fmt.Errorf("at least one of uris, dnsNames or commonNames is required")
+	}
+	return nil
+}
+
+func (s Service) matches(cert *x509.Certificate) bool {
+	for _, u := range cert.URIs {
+		if slices.Contains(s.URIs, u.String()) {
+			return true
+		}
+	}
+	for _, name := range cert.DNSNames {
+		if slices.Contains(s.DNSNames, name) {
+			return true
+		}
+	}
+	return cert.Subject.CommonName != "" && slices.Contains(s.CommonNames, cert.Subject.CommonName)
+}
+
+// Mapper resolves verified client certificates to services.
+type Mapper struct {
+	names    []string
+	services map[string]Service
+}
+
+func NewMapper(services map[string]Service) *Mapper {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	// Sorted so that a certificate matching several services maps stably.
+	sort.Strings(names)
+	return &Mapper{names: names, services: services}
+}
+
+func (m *Mapper) Match(cert *x509.Certificate) (string, Service, bool) {
+	if m == nil {
+		return "", Service{}, false
+	}
+	for _, name := range m.names {
+		if s := m.services[name]; s.matches(cert) {
+			return name, s, true
+		}
+	}
+	return "", Service{}, false
+}
@@ -0,0 +1,75 @@
+package clientcert
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"testing"
+)
+
+func cert(cn string, dns []string, uris ...string) *x509.Certificate {
+	c := &x509.Certificate{Subject: pkix.Name{CommonName: cn}, DNSNames: dns}
+	for _, u := range uris {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			panic(err)
+		}
+		c.URIs = append(c.URIs, parsed)
+	}
+	return c
+}
+
+func TestMatch(t *testing.T) {
+	m := NewMapper(map[string]Service{
+		"moderation": {URIs: []string{"spiffe://snapigw/moderation"}, Scopes: []string{"users:ban"}},
+		"billing":    {DNSNames: []string{"billing.internal"}},
+		"reports":    {CommonNames: []string{"reports"}},
+		"any":        {CommonNames: []string{"shared"}, DNSNames: []string{"shared.internal"}},
+		"zany":       {CommonNames: []string{"shared"}},
+	})
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		want string
+	}{
+		{name: "uri san", cert: cert("", nil, "spiffe://snapigw/moderation"), want: "moderation"},
+		{name: "other uri san", cert: cert("", nil, "spiffe://snapigw/other")},
+		{name: "dns san", cert: cert("", []string{"x.internal", "billing.internal"}), want: "billing"},
+		{name: "common name", cert: cert("reports", nil), want: "reports"},
+		{name: "empty common name", cert: cert("", nil)},
+		{name: "several services match stably", cert: cert("shared", nil), want: "any"},
+		{name: "names are exact", cert: cert("Reports", []string{"billing.internal."})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, s, ok := m.Match(tt.cert)
+			if ok != (tt.want != "") || name != tt.want {
+				t.Fatalf("Match() = %q, %v, want %q", name, ok, tt.want)
+			}
+			if tt.want == "moderation" && len(s.Scopes) != 1 {
+				t.Errorf("Match() returned service %+v", s)
+			}
+		})
+	}
+	var nilMapper *Mapper
+	if _, _, ok := nilMapper.Match(cert("reports", nil)); ok {
+		t.Error("nil mapper matched a certificate")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		s       Service
+		wantErr bool
+	}{
+		{s: Service{URIs: []string{"spiffe://a"}}},
+		{s: Service{DNSNames: []string{"a.internal"}}},
+		{s: Service{CommonNames: []string{"a"}}},
+		{s: Service{Roles: []string{"admin"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := tt.s.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%+v) = %v, want error %v", tt.s, err, tt.wantErr)
+		}
+	}
+}
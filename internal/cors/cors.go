@@ -0,0 +1,125 @@
+package cors
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	defaultMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	defaultHeaders = []string{"Authorization", "Content-Type", "X-Request-ID", "X-API-Key"}
+	knownMethods   = append(slices.Clone(defaultMethods), http.MethodOptions)
+)
+
+// Policy decides which cross-origin callers may use a route. Origins are
+// exact, "*" for any origin, or contain a leading wildcard label such as
+// https://*.example.com, which matches any subdomain but not the apex.
+// Empty AllowMethods and AllowHeaders fall back to common defaults.
+type Policy struct {
+	AllowOrigins     []string      `yaml:"allowOrigins"`
+	AllowMethods     []string      `yaml:"allowMethods"`
+	AllowHeaders     []string      `yaml:"allowHeaders"`
+	ExposeHeaders    []string      `yaml:"exposeHeaders"`
+	AllowCredentials bool          `yaml:"allowCredentials"`
+	MaxAge           time.Duration `yaml:"maxAge"`
+}
+
+// Validate checks the policy and upper-cases AllowMethods in place.
+func (p *Policy) Validate() error {
+	for _, o := range p.AllowOrigins {
+		if o == "*" {
+			if p.AllowCredentials {
+				return fmt.Errorf("cors: wildcard origin can not be combined with credentials")
+			}
+			continue
+		}
+		u, err := url.Parse(strings.Replace(o, "*.", "", 1))
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+			return fmt.Errorf("cors: invalid origin %q", o)
+		}
+		if strings.Contains(o, "*") && !strings.Contains(o, "://*.") {
+			return fmt.Errorf("cors: wildcard must be the leftmost label in %q", o)
+		}
+	}
+	for i, m := range p.AllowMethods {
+		p.AllowMethods[i] = strings.ToUpper(m)
+		if !slices.Contains(knownMethods, p.AllowMethods[i]) {
+			return fmt.Errorf("cors: unsupported method %q", m)
+		}
+	}
+	if p.MaxAge < 0 {
+		return fmt.Errorf("cors: maxAge must not be negative")
+	}
+	return nil
+}
+
+func (p *Policy) allowsOrigin(origin string) bool {
+	for _, o := range p.AllowOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+		scheme, suffix, ok := strings.Cut(o, "://*")
+		if ok && strings.HasPrefix(origin, scheme+"://") {
+			host := strings.TrimPrefix(origin, scheme+"://")
+			if len(host) > len(suffix) && strings.HasSuffix(strings.ToLower(host), strings.ToLower(suffix)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *Policy) anyOrigin() bool {
+	return slices.Contains(p.AllowOrigins, "*")
+}
+
+// Apply sets the response headers for a request from origin and reports
+// whether the origin is allowed.
+func (p *Policy) Apply(h http.Header, origin string) bool {
+	if !p.anyOrigin() {
+		h.Add("Vary", "Origin")
+	}
+	if origin == "" || !p.allowsOrigin(origin) {
+		return false
+	}
+	if p.anyOrigin() {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if len(p.ExposeHeaders) > 0 {
+		h.Set("Access-Control-Expose-Headers", strings.Join(p.ExposeHeaders, ", "))
+	}
+	return true
+}
+
+// ApplyPreflight sets the headers answering a preflight for method.
+func (p *Policy) ApplyPreflight(h http.Header, origin, method string) bool {
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+	methods := p.AllowMethods
+	if len(methods) == 0 {
+		methods = defaultMethods
+	}
+	if !slices.Contains(methods, method) || !p.Apply(h, origin) {
+		return false
+	}
+	headers := p.AllowHeaders
+	if len(headers) == 0 {
+		headers = defaultHeaders
+	}
+	h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	h.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+	if p.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge.Seconds())))
+	}
+	return true
+}
@@ -0,0 +1,186 @@
+package cors
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAllowsOrigin(t *testing.T) {
+	p := &Policy{AllowOrigins: []string{"https://app.example.com", "https://*.example.org"}}
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{origin: "https://app.example.com", want: true},
+		{origin: "https://APP.example.com", want: true},
+		{origin: "http://app.example.com", want: false},
+		{origin: "https://app.example.com:8443", want: false},
+		{origin: "https://other.example.com", want: false},
+		{origin: "https://a.example.org", want: true},
+		{origin: "https://a.b.example.org", want: true},
+		{origin: "https://A.Example.org", want: true},
+		{origin: "https://example.org", want: false},
+		{origin: "https://.example.org", want: false},
+		{origin: "https://evilexample.org", want: false},
+		{origin: "https://a.example.org.evil.com", want: false},
+		{origin: "http://a.example.org", want: false},
+		{origin: "null", want: false},
+	}
+	for _, tt := range tests {
+		if got := p.allowsOrigin(tt.origin); got != tt.want {
+			t.Errorf("allowsOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+	if !(&Policy{AllowOrigins: []string{"*"}}).allowsOrigin("https://anything.test") {
+		t.Error("wildcard policy rejected an origin")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       Policy
+		wantErr bool
+	}{
+		{name: "exact origin", p: Policy{AllowOrigins: []string{"https://a.example.com"}}},
+		{name: "subdomain wildcard", p: Policy{AllowOrigins: []string{"https://*.example.com"}, AllowCredentials: true}},
+		{name: "any origin", p: Policy{AllowOrigins: []string{"*"}}},
+		{name: "any origin with credentials", p: Policy{AllowOrigins: []string{"*"}, AllowCredentials: true}, wantErr: true},
+		{name: "missing scheme", p: Policy{AllowOrigins: []string{"a.example.com"}}, wantErr: true},
+		{name: "path", p: Policy{AllowOrigins: []string{"https://a.example.com/app"}}, wantErr: true},
+		{name: "inner wildcard", p: Policy{AllowOrigins: []string{"https://a.*.example.com"}}, wantErr: true},
+		{name: "partial label wildcard", p: Policy{AllowOrigins: []string{"https://a*.example.com"}}, wantErr: true},
+		{name: "negative max age", p: Policy{AllowOrigins: []string{"https://a.example.com"}, MaxAge: -time.Second}, wantErr: true},
+		{name: "known methods", p: Policy{AllowOrigins: []string{"*"}, AllowMethods: []string{"GET", "options"}}},
+		{name: "unknown method", p: Policy{AllowOrigins: []string{"*"}, AllowMethods: []string{"GET", "FETCH"}}, wantErr: true},
+		{name: "unsupported method", p: Policy{AllowOrigins: []string{"*"}, AllowMethods: []string{"trace"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := tt.p.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateNormalisesMethods(t *testing.T) {
+	p := &Policy{AllowOrigins: []string{"https://a.example.com"}, AllowMethods: []string{"post", "Delete"}}
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{http.MethodPost, http.MethodDelete}; !slices.Equal(p.AllowMethods, want) {
+		t.Errorf("AllowMethods = %v, want %v", p.AllowMethods, want)
+	}
+	h := http.Header{}
+	if !p.ApplyPreflight(h, "https://a.example.com", http.MethodPost) {
+		t.Error("preflight for POST was refused")
+	}
+	if got := h.Get("Access-Control-Allow-Methods"); got != "POST, DELETE" {
+		t.Errorf("Allow-Methods = %q", got)
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name       string
+		p          Policy
+		origin     string
+		want       bool
+		wantOrigin string
+		wantVary   bool
+		wantCreds  bool
+	}{
+		{
+			name:       "allowed origin is echoed",
+			p:          Policy{AllowOrigins: []string{"https://*.example.com"}, AllowCredentials: true, ExposeHeaders: []string{"X-Request-ID"}},
+			origin:     "https://a.example.com",
+			want:       true,
+			wantOrigin: "https://a.example.com",
+			wantVary:   true,
+			wantCreds:  true,
+		},
+		{
+			name:     "other origin gets no headers",
+			p:        Policy{AllowOrigins: []string{"https://a.example.com"}, AllowCredentials: true},
+			origin:   "https://b.example.com",
+			wantVary: true,
+		},
+		{
+			name:     "same-origin request",
+			p:        Policy{AllowOrigins: []string{"https://a.example.com"}},
+			wantVary: true,
+		},
+		{
+			name:       "any origin is not echoed",
+			p:          Policy{AllowOrigins: []string{"*"}},
+			origin:     "https://a.example.com",
+			want:       true,
+			wantOrigin: "*",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			if got := tt.p.Apply(h, tt.origin); got != tt.want {
+				t.Fatalf("Apply() = %v, want %v", got, tt.want)
+			}
+			if got := h.Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := h.Get("Vary") == "Origin"; got != tt.wantVary {
+				t.Errorf("Vary = %q", h.Get("Vary"))
+			}
+			if got := h.Get("Access-Control-Allow-Credentials") == "true"; got != tt.wantCreds {
+				t.Errorf("Allow-Credentials = %q", h.Get("Access-Control-Allow-Credentials"))
+			}
+			if tt.want && len(tt.p.ExposeHeaders) > 0 && h.Get("Access-Control-Expose-Headers") == "" {
+				t.Error("Expose-Headers not set")
+			}
+		})
+	}
+}
+
+func TestApplyPreflight(t *testing.T) {
+	p := &Policy{
+		AllowOrigins: []string{"https://*.example.com"},
+		AllowMethods: []string{http.MethodPost},
+		AllowHeaders: []string{"X-API-Key", "Content-Type"},
+		MaxAge:       10 * time.Minute,
+	}
+	tests := []struct {
+		name   string
+		origin string
+		method string
+		want   bool
+	}{
+		{name: "allowed", origin: "https://a.example.com", method: http.MethodPost, want: true},
+		{name: "method not allowed", origin: "https://a.example.com", method: http.MethodDelete},
+		{name: "origin not allowed", origin: "https://a.example.net", method: http.MethodPost},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			if got := p.ApplyPreflight(h, tt.origin, tt.method); got != tt.want {
+				t.Fatalf("ApplyPreflight() = %v, want %v", got, tt.want)
+			}
+			if !tt.want {
+				if h.Get("Access-Control-Allow-Methods") != "" || h.Get("Access-Control-Allow-Origin") != "" {
+					t.Errorf("denied preflight set headers %v", h)
+				}
+				return
+			}
+			want := map[string]string{
+				"Access-Control-Allow-Origin":  tt.origin,
+				"Access-Control-Allow-Methods": "POST",
+				"Access-Control-Allow-Headers": "X-API-Key, Content-Type",
+				"Access-Control-Max-Age":       "600",
+			}
+			for k, v := range want {
+				if got := h.Get(k); got != v {
+					t.Errorf("%s = %q, want %q", k, got, v)
+				}
+			}
+		})
+	}
+}
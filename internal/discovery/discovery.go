@@ -0,0 +1,244 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer/leastrequest"
+	"google.golang.org/grpc/balancer/roundrobin"
+	_ "google.golang.org/grpc/health" // enables client-side health checking
+	"google.golang.org/grpc/resolver"
+)
+
+const (
+	ModeStatic = "static"
+	ModeDNSSRV = "dns_srv"
+	ModeFile   = "file"
+)
+
+const (
+	BalancerRoundRobin   = "round_robin"
+	BalancerLeastRequest = "least_request"
+)
+
+const scheme = "snapigw"
+
+// Config describes how to find the endpoints of one upstream. Target is a
+// comma separated list of host:port for static, an SRV name such as
+// _grpc._tcp.auth.example.com for dns_srv, or the path of a file listing one
+// host:port per line for file. Dynamic targets are re-read every Refresh.
+type Config struct {
+	Mode        string
+	Target      string
+	Balancer    string
+	HealthCheck bool
+	Refresh     time.Duration
+}
+
+func (c Config) Validate() error {
+	switch c.Mode {
+	case ModeStatic, ModeDNSSRV, ModeFile:
+	default:
+		return fmt.Errorf("unknown discovery mode %q", c.Mode)
+	}
+	switch c.Balancer {
+	case BalancerRoundRobin, BalancerLeastRequest:
+	default:
+		return fmt.Errorf("unknown balancer %q", c.Balancer)
+	}
+	if c.Target == "" {
+		return fmt.Errorf("discovery target is required")
+	}
+	if c.Mode == ModeStatic {
+		if _, err := parseList(c.Target, ","); err != nil {
+			return err
+		}
+	}
+	if c.Mode != ModeStatic && c.Refresh <= 0 {
+		return fmt.Errorf("discovery refresh must be positive")
+	}
+	return nil
+}
+
+// DialOptions returns the target and options that make a gRPC client resolve
+// name through c, balance calls across the endpoints found and, when enabled,
+// stop sending calls to endpoints failing the standard health check.
+func DialOptions(name string, c Config, l zerolog.Logger) (string, []grpc.DialOption, error) {
+	if err := c.Validate(); err != nil {
+		return "", nil, errors.Wrapf(err, "upstream %s", name)
+	}
+	lb := fmt.Sprintf(`{%q:{}}`, roundrobin.Name)
+	if c.Balancer == BalancerLeastRequest {
+		lb = fmt.Sprintf(`{%q:{"choiceCount":2}}`, leastrequest.Name)
+	}
+	sc := `{"loadBalancingConfig":[` + lb + `]`
+	if c.HealthCheck {
+		sc += `,"healthCheckConfig":{"serviceName":""}`
+	}
+	sc += `}`
+	b := &builder{cfg: c, l: l.With().Str("upstream", name).Logger()}
+	opts := []grpc.DialOption{
+		grpc.WithResolvers(b),
+		grpc.WithDefaultServiceConfig(sc),
+	}
+	return scheme + ":///" + name, opts, nil
+}
+
+type builder struct {
+	cfg Config
+	l   zerolog.Logger
+}
+
+func (b *builder) Scheme() string {
+	return scheme
+}
+
+func (b *builder) Build(_ resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &watcher{
+		cfg:    b.cfg,
+		l:      b.l,
+		cc:     cc,
+		cancel: cancel,
+		now:    make(chan struct{}, 1),
+	}
+	r.wg.Add(1)
+	go r.run(ctx)
+	return r, nil
+}
+
+// watcher looks endpoints up on start, every Refresh and whenever gRPC asks
+// for re-resolution, pushing changes to the client connection.
+type watcher struct {
+	cfg    Config
+	l      zerolog.Logger
+	cc     resolver.ClientConn
+	cancel context.CancelFunc
+	now    chan struct{}
+	wg     sync.WaitGroup
+	last   string
+}
+
+func (r *watcher) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.now <- struct{}{}:
+	default:
+	}
+}
+
+func (r *watcher) Close() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+func (r *watcher) run(ctx context.Context) {
+	defer r.wg.Done()
+	var tick <-chan time.Time
+	if r.cfg.Mode != ModeStatic {
+		t := time.NewTicker(r.cfg.Refresh)
+		defer t.Stop()
+		tick = t.C
+	}
+	for {
+		r.resolve(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+		case <-r.now:
+		}
+	}
+}
+
+func (r *watcher) resolve(ctx context.Context) {
+	addrs, err := r.lookup(ctx)
+	if err == nil && len(addrs) == 0 {
+		err = errors.New("no endpoints found")
+	}
+	if err != nil {
+		r.l.Error().Err(err).Msg("failed to discover upstream endpoints")
+		// Keep serving from the last known endpoints.
+		if r.last == "" {
+			r.cc.ReportError(err)
+		}
+		return
+	}
+	key := strings.Join(addrs, ",")
+	if key == r.last {
+		return
+	}
+	// Balancers built on balancer/base still read Addresses rather than Endpoints.
+	state := resolver.State{
+		Addresses: make([]resolver.Address, len(addrs)),
+		Endpoints: make([]resolver.Endpoint, len(addrs)),
+	}
+	for i, a := range addrs {
+		// Verify TLS against the endpoint host rather than the upstream name.
+		host, _, _ := net.SplitHostPort(a)
+		addr := resolver.Address{Addr: a, ServerName: host}
+		state.Addresses[i] = addr
+		state.Endpoints[i] = resolver.Endpoint{Addresses: []resolver.Address{addr}}
+	}
+	if err := r.cc.UpdateState(state); err != nil {
+		r.l.Warn().Err(err).Msg("upstream endpoints were not accepted")
+	}
+	r.l.Info().Strs("endpoints", addrs).Msg("upstream endpoints updated")
+	r.last = key
+}
+
+func (r *watcher) lookup(ctx context.Context) ([]string, error) {
+	switch r.cfg.Mode {
+	case ModeDNSSRV:
+		return lookupSRV(ctx, r.cfg.Target)
+	case ModeFile:
+		b, err := os.ReadFile(r.cfg.Target)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read endpoints file")
+		}
+		return parseList(string(b), "\n")
+	default:
+		return parseList(r.cfg.Target, ",")
+	}
+}
+
+func lookupSRV(ctx context.Context, name string) ([]string, error) {
+	_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to look up srv records")
+	}
+	addrs := make([]string, 0, len(records))
+	for _, rec := range records {
+		host := strings.TrimSuffix(rec.Target, ".")
+		addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(int(rec.Port))))
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
+
+// parseList reads host:port entries separated by sep. Blank entries and
+// lines starting with # are skipped.
+func parseList(s, sep string) ([]string, error) {
+	var addrs []string
+	for _, a := range strings.Split(s, sep) {
+		a = strings.TrimSpace(a)
+		if a == "" || strings.HasPrefix(a, "#") {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(a); err != nil {
+			return nil, errors.Wrapf(err, "invalid endpoint %q", a)
+		}
+		addrs = append(addrs, a)
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
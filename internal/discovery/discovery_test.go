@@ -0,0 +1,167 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc/resolver"
+)
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		name    string
+		s, sep  string
+		want    []string
+		wantErr bool
+	}{
+		{name: "comma separated", s: "b:1, a:2", sep: ",", want: []string{"a:2", "b:1"}},
+		{name: "file lines", s: "# auth\n10.0.0.2:50051\n\n[::1]:50051\n", sep: "\n", want: []string{"10.0.0.2:50051", "[::1]:50051"}},
+		{name: "empty", s: " , ", sep: ",", want: nil},
+		{name: "missing port", s: "a:1,b", sep: ",", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseList(tt.s, tt.sep)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: parseList() error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: parseList() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := Config{Mode: ModeStatic, Target: "a:1", Balancer: BalancerRoundRobin}
+	tests := []struct {
+		name    string
+		change  func(c *Config)
+		wantErr bool
+	}{
+		{name: "static", change: func(c *Config) {}},
+		{name: "least request", change: func(c *Config) { c.Balancer = BalancerLeastRequest }},
+		{name: "dynamic with refresh", change: func(c *Config) { c.Mode, c.Target, c.Refresh = ModeDNSSRV, "_grpc._tcp.auth", time.Second }},
+		{name: "dynamic without refresh", change: func(c *Config) { c.Mode, c.Target = ModeFile, "endpoints" }, wantErr: true},
+		{name: "unknown mode", change: func(c *Config) { c.Mode = "consul" }, wantErr: true},
+		{name: "unknown balancer", change: func(c *Config) { c.Balancer = "random" }, wantErr: true},
+		{name: "missing target", change: func(c *Config) { c.Target = "" }, wantErr: true},
+		{name: "bad static target", change: func(c *Config) { c.Target = "a" }, wantErr: true},
+	}
+	for _, tt := range tests {
+		c := valid
+		tt.change(&c)
+		if err := c.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestDialOptions(t *testing.T) {
+	target, opts, err := DialOptions("auth", Config{Mode: ModeStatic, Target: "a:1", Balancer: BalancerRoundRobin}, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "snapigw:///auth" || len(opts) != 2 {
+		t.Errorf("DialOptions() = %q, %d options", target, len(opts))
+	}
+	if _, _, err := DialOptions("auth", Config{}, zerolog.Nop()); err == nil || !strings.Contains(err.Error(), "upstream auth") {
+		t.Errorf("DialOptions() with an invalid config = %v", err)
+	}
+}
+
+// clientConn records the endpoints pushed by a watcher.
+type clientConn struct {
+	resolver.ClientConn
+	states chan resolver.State
+	errs   chan error
+}
+
+func (c *clientConn) UpdateState(s resolver.State) error {
+	c.states <- s
+	return nil
+}
+
+func (c *clientConn) ReportError(err error) {
+	c.errs <- err
+}
+
+func (c *clientConn) next(t *testing.T) []string {
+	t.Helper()
+	select {
+	case s := <-c.states:
+		addrs := make([]string, len(s.Addresses))
+		for i, a := range s.Addresses {
+			addrs[i] = a.Addr
+			if host := strings.Split(a.Addr, ":")[0]; a.ServerName != host {
+				t.Errorf("address %s has server name %q", a.Addr, a.ServerName)
+			}
+		}
+		if len(s.Endpoints) != len(s.Addresses) {
+			t.Errorf("%d endpoints for %d addresses", len(s.Endpoints), len(s.Addresses))
+		}
+		return addrs
+	case <-time.After(time.Second):
+		t.Fatal("no endpoints were pushed")
+		return nil
+	}
+}
+
+func (c *clientConn) quiet(t *testing.T) {
+	t.Helper()
+	select {
+	case s := <-c.states:
+		t.Fatalf("unexpected update %v", s.Addresses)
+	case err := <-c.errs:
+		t.Fatalf("unexpected error %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestFileWatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "endpoints")
+	write := func(s string) {
+		if err := os.WriteFile(path, []byte(s), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := &builder{cfg: Config{Mode: ModeFile, Target: path, Refresh: time.Hour}, l: zerolog.Nop()}
+	cc := &clientConn{states: make(chan resolver.State, 1), errs: make(chan error, 1)}
+
+	r, err := b.Build(resolver.Target{}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	select {
+	case <-cc.errs:
+	case <-time.After(time.Second):
+		t.Fatal("missing file was not reported")
+	}
+
+	write("b:1\na:1\n")
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	if got := cc.next(t); !slices.Equal(got, []string{"a:1", "b:1"}) {
+		t.Fatalf("endpoints = %v", got)
+	}
+
+	// Unchanged endpoints are not pushed again.
+	write("a:1\nb:1\n")
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	cc.quiet(t)
+
+	// A broken file keeps the last known endpoints without an error.
+	write("a:1\nb\n")
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	cc.quiet(t)
+
+	write("c:1\n")
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	if got := cc.next(t); !slices.Equal(got, []string{"c:1"}) {
+		t.Fatalf("endpoints = %v", got)
+	}
+}
@@ -0,0 +1,46 @@
+package health
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// CheckMethod is the method called by GRPC checks. Keep it out of the
+// interceptors of the checked connection, see upstream.Except.
+const CheckMethod = healthpb.Health_Check_FullMethodName
+
+type stateful interface {
+	GetState() connectivity.State
+}
+
+// GRPC checks an upstream with the standard health checking protocol. Servers
+// that do not implement it are considered healthy once the connection is ready.
+func GRPC(conn grpc.ClientConnInterface) Check {
+	client := healthpb.NewHealthClient(conn)
+	return func(ctx context.Context) error {
+		res, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		switch {
+		case status.Code(err) == codes.Unimplemented:
+			if sc, ok := conn.(stateful); ok {
+				if s := sc.GetState(); s != connectivity.Ready {
+					return fmt.Errorf("connection is %s", s)
+				}
+			}
+			return nil
+		case err != nil:
+			if sc, ok := conn.(stateful); ok {
+				return fmt.Errorf("connection is %s: %s", sc.GetState(), status.Convert(err).Message())
+			}
+			return fmt.Errorf("health check failed: %s", status.Convert(err).Message())
+		case res.GetStatus() != healthpb.HealthCheckResponse_SERVING:
+			return fmt.Errorf("upstream is %s", res.GetStatus())
+		}
+		return nil
+	}
+}
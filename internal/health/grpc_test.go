@@ -0,0 +1,101 @@
+package health
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthgrpc "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/vindosVP/snapigw/internal/upstream"
+)
+
+func serveHealth(t *testing.T, status healthpb.HealthCheckResponse_ServingStatus) *bufconn.Listener {
+	t.Helper()
+	lis := bufconn.Listen(1 << 16)
+	srv := grpc.NewServer()
+	hs := healthgrpc.NewServer()
+	hs.SetServingStatus("", status)
+	healthpb.RegisterHealthServer(srv, hs)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+	return lis
+}
+
+func dial(t *testing.T, lis *bufconn.Listener, ic grpc.UnaryClientInterceptor) *grpc.ClientConn {
+	t.Helper()
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(ic),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestGRPC(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  healthpb.HealthCheckResponse_ServingStatus
+		wantErr bool
+	}{
+		{name: "serving", status: healthpb.HealthCheckResponse_SERVING},
+		{name: "not serving", status: healthpb.HealthCheckResponse_NOT_SERVING, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := dial(t, serveHealth(t, tt.status), upstream.Except(nil))
+			if err := GRPC(conn)(context.Background()); (err != nil) != tt.wantErr {
+				t.Fatalf("check = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOpenBreakerKeepsReadiness(t *testing.T) {
+	tests := []struct {
+		name      string
+		except    []string
+		wantReady bool
+	}{
+		{name: "health checks bypass the breaker", except: []string{CheckMethod}, wantReady: true},
+		{name: "health checks through the breaker", wantReady: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The upstream serves nothing but health checks, so a single
+			// call to another method opens the breaker.
+			br := upstream.NewBreaker("auth", upstream.BreakerConfig{
+				FailureRate:      1,
+				MinRequests:      1,
+				Window:           time.Minute,
+				OpenDuration:     time.Hour,
+				HalfOpenRequests: 1,
+				Codes:            []string{"UNIMPLEMENTED"},
+			})
+			conn := dial(t, serveHealth(t, healthpb.HealthCheckResponse_SERVING), upstream.Except(tt.except, br.UnaryClientInterceptor()))
+			_ = conn.Invoke(context.Background(), "/auth.Auth/Login", &emptypb.Empty{}, &emptypb.Empty{})
+			if err := br.Check(context.Background()); err == nil {
+				t.Fatal("breaker did not open")
+			}
+
+			h := New(time.Second).With("auth", GRPC(conn)).WithInfo("auth_breaker", br.Check)
+			r, ok := h.Ready(context.Background())
+			if ok != tt.wantReady {
+				t.Fatalf("Ready() = %+v, want ready %v", r, tt.wantReady)
+			}
+			if r.Checks["auth_breaker"].Status != StatusFail {
+				t.Errorf("breaker state missing from the report: %+v", r.Checks)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOk           = "ok"
+	StatusFail         = "fail"
+	StatusReady        = "ready"
+	StatusNotReady     = "not_ready"
+	StatusShuttingDown = "shutting_down"
+)
+
+// Check reports whether a dependency is usable. It must honour ctx.
+type Check func(ctx context.Context) error
+
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+type Result struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Health serves liveness and readiness. Readiness runs every registered check
+// and fails once shutdown has begun, so that traffic is drained first.
+type Health struct {
+	timeout      time.Duration
+	mu           sync.RWMutex
+	checks       map[string]Check
+	info         map[string]bool
+	shuttingDown atomic.Bool
+}
+
+func New(timeout time.Duration) *Health {
+	return &Health{timeout: timeout, checks: make(map[string]Check), info: make(map[string]bool)}
+}
+
+func (h *Health) With(name string, c Check) *Health {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = c
+	delete(h.info, name)
+	return h
+}
+
+// WithInfo registers a check that is included in the readiness report but
+// never makes readiness fail.
+func (h *Health) WithInfo(name string, c Check) *Health {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = c
+	h.info[name] = true
+	return h
+}
+
+// Shutdown makes readiness fail from now on.
+func (h *Health) Shutdown() {
+	h.shuttingDown.Store(true)
+}
+
+func (h *Health) Ready(ctx context.Context) (Report, bool) {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	h.mu.RLock()
+	names := make([]string, 0, len(h.checks))
+	for name := range h.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	results := make([]Result, len(names))
+	info := make([]bool, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		info[i] = h.info[name]
+		wg.Add(1)
+		go func(i int, c Check) {
+			defer wg.Done()
+			results[i] = Result{Status: StatusOk}
+			if err := c(ctx); err != nil {
+				results[i] = Result{Status: StatusFail, Error: err.Error()}
+			}
+		}(i, h.checks[name])
+	}
+	h.mu.RUnlock()
+	wg.Wait()
+
+	r := Report{Status: StatusReady, Checks: make(map[string]Result, len(names))}
+	for i, name := range names {
+		r.Checks[name] = results[i]
+		if results[i].Status != StatusOk && !info[i] {
+			r.Status = StatusNotReady
+		}
+	}
+	if h.shuttingDown.Load() {
+		r.Status = StatusShuttingDown
+	}
+	return r, r.Status == StatusReady
+}
+
+// LivenessHandler reports that the process is up and serving HTTP.
+func (h *Health) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, Report{Status: StatusOk})
+	})
+}
+
+func (h *Health) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report, ok := h.Ready(r.Context())
+		code := http.StatusOK
+		if !ok {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, report)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,130 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func pass(context.Context) error { return nil }
+
+func fail(context.Context) error { return errors.New("down") }
+
+func block(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestReady(t *testing.T) {
+	tests := []struct {
+		name       string
+		checks     map[string]Check
+		info       map[string]Check
+		shutdown   bool
+		wantStatus string
+		wantChecks map[string]string
+	}{
+		{
+			name:       "no checks",
+			wantStatus: StatusReady,
+		},
+		{
+			name:       "all checks pass",
+			checks:     map[string]Check{"a": pass, "b": pass},
+			wantStatus: StatusReady,
+			wantChecks: map[string]string{"a": StatusOk, "b": StatusOk},
+		},
+		{
+			name:       "a failing check fails readiness",
+			checks:     map[string]Check{"a": pass, "b": fail},
+			wantStatus: StatusNotReady,
+			wantChecks: map[string]string{"a": StatusOk, "b": StatusFail},
+		},
+		{
+			name:       "a slow check times out",
+			checks:     map[string]Check{"a": block},
+			wantStatus: StatusNotReady,
+			wantChecks: map[string]string{"a": StatusFail},
+		},
+		{
+			name:       "a failing info check is reported only",
+			checks:     map[string]Check{"a": pass},
+			info:       map[string]Check{"breaker": fail},
+			wantStatus: StatusReady,
+			wantChecks: map[string]string{"a": StatusOk, "breaker": StatusFail},
+		},
+		{
+			name:       "shutdown wins",
+			checks:     map[string]Check{"a": pass},
+			shutdown:   true,
+			wantStatus: StatusShuttingDown,
+			wantChecks: map[string]string{"a": StatusOk},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(50 * time.Millisecond)
+			for name, c := range tt.checks {
+				h.With(name, c)
+			}
+			for name, c := range tt.info {
+				h.WithInfo(name, c)
+			}
+			if tt.shutdown {
+				h.Shutdown()
+			}
+			r, ok := h.Ready(context.Background())
+			if r.Status != tt.wantStatus || ok != (tt.wantStatus == StatusReady) {
+				t.Fatalf("Ready() = %q, %v, want %q", r.Status, ok, tt.wantStatus)
+			}
+			if len(r.Checks) != len(tt.wantChecks) {
+				t.Fatalf("checks = %v, want %v", r.Checks, tt.wantChecks)
+			}
+			for name, want := range tt.wantChecks {
+				if got := r.Checks[name]; got.Status != want {
+					t.Errorf("check %q = %+v, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWithReplacesInfoCheck(t *testing.T) {
+	h := New(time.Second).WithInfo("a", fail).With("a", fail)
+	if _, ok := h.Ready(context.Background()); ok {
+		t.Error("Ready() = true after re-registering a failing check as critical")
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	h := New(time.Second).With("a", fail)
+	tests := []struct {
+		name       string
+		handler    http.Handler
+		wantCode   int
+		wantStatus string
+	}{
+		{name: "liveness ignores checks", handler: h.LivenessHandler(), wantCode: http.StatusOK, wantStatus: StatusOk},
+		{name: "readiness fails", handler: h.ReadinessHandler(), wantCode: http.StatusServiceUnavailable, wantStatus: StatusNotReady},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			if w.Code != tt.wantCode {
+				t.Errorf("code = %d, want %d", w.Code, tt.wantCode)
+			}
+			var r Report
+			if err := json.NewDecoder(w.Body).Decode(&r); err != nil {
+				t.Fatal(err)
+			}
+			if r.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", r.Status, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package identity
+
+import "github.com/gin-gonic/gin"
+
+const contextKey = "identity"
+
+const (
+	KindUser    = "user"
+	KindService = "service"
+	KindAPIKey  = "api_key"
+)
+
+// Authentication methods a route group may accept.
+const (
+	MethodJWT        = "jwt"
+	MethodClientCert = "client_cert"
+	MethodAPIKey     = "api_key"
+)
+
+// Identity describes the authenticated caller of a request.
+type Identity struct {
+	Kind  string
+	Id    string
+	Email string
+	// Owner is the party an API key was issued to.
+	Owner  string
+	Admin  bool
+	Roles  []string
+	Scopes []string
+}
+
+func Set(c *gin.Context, id *Identity) {
+	c.Set(contextKey, id)
+}
+
+func From(c *gin.Context) (*Identity, bool) {
+	v, ok := c.Get(contextKey)
+	if !ok {
+		return nil, false
+	}
+	id, ok := v.(*Identity)
+	return id, ok
+}
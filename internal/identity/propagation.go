@@ -0,0 +1,120 @@
+package identity
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	ModeNone     = "none"
+	ModeMetadata = "metadata"
+	ModeHeaders  = "headers"
+)
+
+const InternalTokenKey = "x-internal-token"
+
+type keys struct {
+	id, kind, email, owner, admin, roles, scopes string
+}
+
+var modeKeys = map[string]keys{
+	ModeMetadata: {id: "userId", kind: "userKind", email: "userEmail", owner: "userOwner", admin: "userIsAdmin", roles: "userRoles", scopes: "userScopes"},
+	ModeHeaders:  {id: "x-user-id", kind: "x-user-kind", email: "x-user-email", owner: "x-user-owner", admin: "x-user-admin", roles: "x-user-roles", scopes: "x-user-scopes"},
+}
+
+type InternalClaims struct {
+	jwt.RegisteredClaims
+	Kind    string   `json:"kind"`
+	Email   string   `json:"email,omitempty"`
+	Owner   string   `json:"owner,omitempty"`
+	IsAdmin bool     `json:"isAdmin"`
+	Roles   []string `json:"roles,omitempty"`
+	Scope   string   `json:"scope,omitempty"`
+}
+
+// Propagator forwards the caller identity to upstream services as gRPC
+// metadata and, when a secret is configured, as a short-lived internal JWT
+// signed by the gateway.
+type Propagator struct {
+	mode   string
+	issuer string
+	secret []byte
+	ttl    time.Duration
+}
+
+func NewPropagator(mode string) (*Propagator, error) {
+	if _, ok := modeKeys[mode]; !ok && mode != ModeNone {
+		return nil, errors.Errorf("unknown identity propagation mode %q", mode)
+	}
+	return &Propagator{mode: mode}, nil
+}
+
+func (p *Propagator) WithInternalToken(issuer, secret string, ttl time.Duration) *Propagator {
+	p.issuer = issuer
+	p.secret = []byte(secret)
+	p.ttl = ttl
+	return p
+}
+
+// OutgoingContext builds the context for an upstream call made on behalf of c.
+// The request id is always forwarded, even by a nil Propagator. It fails when
+// the internal token can not be signed, since upstreams would then see an
+// anonymous call.
+func (p *Propagator) OutgoingContext(c *gin.Context) (context.Context, error) {
+	md := metadata.Pairs("requestId", c.GetString("requestId"))
+	id, ok := From(c)
+	if p == nil || !ok {
+		return metadata.NewOutgoingContext(c, md), nil
+	}
+	if k, ok := modeKeys[p.mode]; ok {
+		md.Set(k.id, id.Id)
+		md.Set(k.kind, id.Kind)
+		md.Set(k.admin, strconv.FormatBool(id.Admin))
+		if id.Email != "" {
+			md.Set(k.email, id.Email)
+		}
+		if id.Owner != "" {
+			md.Set(k.owner, id.Owner)
+		}
+		if len(id.Roles) > 0 {
+			md.Set(k.roles, strings.Join(id.Roles, ","))
+		}
+		if len(id.Scopes) > 0 {
+			md.Set(k.scopes, strings.Join(id.Scopes, " "))
+		}
+	}
+	if len(p.secret) > 0 {
+		token, err := p.internalToken(id)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to sign internal token")
+		}
+		md.Set(InternalTokenKey, token)
+	}
+	return metadata.NewOutgoingContext(c, md), nil
+}
+
+func (p *Propagator) internalToken(id *Identity) (string, error) {
+	now := time.Now()
+	claims := &InternalClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    p.issuer,
+			Subject:   id.Id,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(p.ttl)),
+		},
+		Kind:    id.Kind,
+		Email:   id.Email,
+		Owner:   id.Owner,
+		IsAdmin: id.Admin,
+		Roles:   id.Roles,
+		Scope:   strings.Join(id.Scopes, " "),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(p.secret)
+}
@@ -0,0 +1,125 @@
+package identity
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestOutgoingContext(t *testing.T) {
+	user := &Identity{Kind: KindUser, Id: "7", Email: "a@b.c", Admin: true, Roles: []string{"admin", "ops"}, Scopes: []string{"users:ban", "users:read"}}
+	key := &Identity{Kind: KindAPIKey, Id: "k1", Owner: "partner", Scopes: []string{"orders:read"}}
+	tests := []struct {
+		name     string
+		mode     string
+		nilProp  bool
+		identity *Identity
+		want     map[string]string
+	}{
+		{
+			name:     "nil propagator forwards the request id",
+			nilProp:  true,
+			identity: user,
+			want:     map[string]string{"requestid": "r1"},
+		},
+		{
+			name: "anonymous caller",
+			mode: ModeMetadata,
+			want: map[string]string{"requestid": "r1"},
+		},
+		{
+			name:     "none",
+			mode:     ModeNone,
+			identity: user,
+			want:     map[string]string{"requestid": "r1"},
+		},
+		{
+			name:     "metadata",
+			mode:     ModeMetadata,
+			identity: user,
+			want: map[string]string{
+				"requestid": "r1", "userid": "7", "userkind": "user", "useremail": "a@b.c",
+				"userisadmin": "true", "userroles": "admin,ops", "userscopes": "users:ban users:read",
+			},
+		},
+		{
+			name:     "headers",
+			mode:     ModeHeaders,
+			identity: key,
+			want: map[string]string{
+				"requestid": "r1", "x-user-id": "k1", "x-user-kind": "api_key", "x-user-owner": "partner",
+				"x-user-admin": "false", "x-user-scopes": "orders:read",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p *Propagator
+			if !tt.nilProp {
+				var err error
+				if p, err = NewPropagator(tt.mode); err != nil {
+					t.Fatal(err)
+				}
+			}
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Set("requestId", "r1")
+			if tt.identity != nil {
+				Set(c, tt.identity)
+			}
+			ctx, err := p.OutgoingContext(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			md, _ := metadata.FromOutgoingContext(ctx)
+			if len(md) != len(tt.want) {
+				t.Errorf("metadata = %v, want %v", md, tt.want)
+			}
+			for k, v := range tt.want {
+				if got := md.Get(k); len(got) != 1 || got[0] != v {
+					t.Errorf("metadata[%s] = %v, want %q", k, got, v)
+				}
+			}
+		})
+	}
+}
+
+func TestInternalToken(t *testing.T) {
+	p, err := NewPropagator(ModeNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.WithInternalToken("gateway", "secret", time.Minute)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	Set(c, &Identity{Kind: KindService, Id: "moderation", Roles: []string{"mod"}, Scopes: []string{"users:ban", "users:delete"}})
+	ctx, err := p.OutgoingContext(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	tokens := md.Get(InternalTokenKey)
+	if len(tokens) != 1 {
+		t.Fatalf("internal token = %v, want one", tokens)
+	}
+	claims := &InternalClaims{}
+	if _, err := jwt.ParseWithClaims(tokens[0], claims, func(*jwt.Token) (interface{}, error) {
+		return []byte("secret"), nil
+	}, jwt.WithIssuer("gateway"), jwt.WithSubject("moderation")); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Kind != KindService || claims.Scope != "users:ban users:delete" || len(claims.Roles) != 1 {
+		t.Errorf("claims = %+v", claims)
+	}
+	if ttl := claims.ExpiresAt.Sub(claims.IssuedAt.Time); ttl != time.Minute {
+		t.Errorf("token lifetime = %v, want 1m", ttl)
+	}
+}
+
+func TestNewPropagatorRejectsUnknownMode(t *testing.T) {
+	if _, err := NewPropagator("cookies"); err == nil {
+		t.Error("NewPropagator() succeeded, want error")
+	}
+}
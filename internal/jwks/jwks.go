@@ -0,0 +1,273 @@
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// minRefetch bounds how often an unknown kid may trigger an out-of-band fetch.
+const minRefetch = 30 * time.Second
+
+type key struct {
+	alg      string
+	pub      crypto.PublicKey
+	lastSeen time.Time
+}
+
+// KeySet holds public keys from a JWKS document loaded from a file or an
+// HTTP(S) URL. Keys dropped from the document stay valid for the grace
+// period so tokens signed before a rotation keep verifying.
+type KeySet struct {
+	source    string
+	grace     time.Duration
+	client    *http.Client
+	l         zerolog.Logger
+	mu        sync.RWMutex
+	keys      map[string]key
+	fetchedAt time.Time
+	fetchMu   sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type document struct {
+	Keys []jwk `json:"keys"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func New(source string, refresh, grace time.Duration, l zerolog.Logger) (*KeySet, error) {
+	ks := &KeySet{
+		source: source,
+		grace:  grace,
+		client: &http.Client{Timeout: 10 * time.Second},
+		l:      l.With().Str("jwks", source).Logger(),
+		keys:   make(map[string]key),
+		done:   make(chan struct{}),
+	}
+	if err := ks.refresh(); err != nil {
+		return nil, err
+	}
+	if refresh > 0 {
+		go ks.refreshLoop(refresh)
+	}
+	return ks, nil
+}
+
+func (ks *KeySet) Close() {
+	ks.closeOnce.Do(func() { close(ks.done) })
+}
+
+// Keyfunc resolves the verification key for token by its kid header.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid")
+	}
+	k, ok := ks.lookup(kid)
+	if !ok {
+		ks.refetch()
+		if k, ok = ks.lookup(kid); !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+	}
+	if k.alg != "" && k.alg != token.Method.Alg() {
+		return nil, fmt.Errorf("key %q can not verify %s tokens", kid, token.Method.Alg())
+	}
+	return k.pub, nil
+}
+
+func (ks *KeySet) lookup(kid string) (key, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	k, ok := ks.keys[kid]
+	return k, ok
+}
+
+func (ks *KeySet) refetch() {
+	ks.fetchMu.Lock()
+	defer ks.fetchMu.Unlock()
+	ks.mu.RLock()
+	recent := time.Since(ks.fetchedAt) < minRefetch
+	ks.mu.RUnlock()
+	if recent {
+		return
+	}
+	if err := ks.refresh(); err != nil {
+		ks.l.Error().Err(err).Msg("failed to refresh jwks")
+	}
+}
+
+func (ks *KeySet) refreshLoop(every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ks.done:
+			return
+		case <-t.C:
+			if err := ks.refresh(); err != nil {
+				ks.l.Error().Err(err).Msg("failed to refresh jwks")
+			}
+		}
+	}
+}
+
+func (ks *KeySet) refresh() error {
+	b, err := ks.read()
+	if err != nil {
+		return err
+	}
+	doc := &document{}
+	if err := json.Unmarshal(b, doc); err != nil {
+		return errors.Wrap(err, "failed to parse jwks")
+	}
+	now := time.Now()
+	fresh := make(map[string]key, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if k.Kid == "" {
+			ks.l.Warn().Msg("skipping jwk without kid")
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			ks.l.Warn().Err(err).Str("kid", k.Kid).Msg("skipping invalid jwk")
+			continue
+		}
+		fresh[k.Kid] = key{alg: k.Alg, pub: pub, lastSeen: now}
+	}
+	if len(fresh) == 0 {
+		return errors.New("jwks contains no usable signing keys")
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	for kid, k := range ks.keys {
+		if _, ok := fresh[kid]; !ok && now.Sub(k.lastSeen) < ks.grace {
+			fresh[kid] = k
+		}
+	}
+	ks.keys = fresh
+	ks.fetchedAt = now
+	ks.l.Debug().Int("keys", len(fresh)).Msg("jwks refreshed")
+	return nil
+}
+
+func (ks *KeySet) read() ([]byte, error) {
+	if !strings.HasPrefix(ks.source, "http://") && !strings.HasPrefix(ks.source, "https://") {
+		b, err := os.ReadFile(ks.source)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read jwks file")
+		}
+		return b, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ks.client.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.source, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create jwks request")
+	}
+	res, err := ks.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch jwks")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch jwks: unexpected status %d", res.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, errors.Wrap(err, "bad modulus")
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, errors.Wrap(err, "bad exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, errors.Wrap(err, "bad x coordinate")
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, errors.Wrap(err, "bad y coordinate")
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, errors.Wrap(err, "bad public key")
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("bad public key size")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
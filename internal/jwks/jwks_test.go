@@ -0,0 +1,220 @@
+package jwks
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog"
+)
+
+type signer struct {
+	kid    string
+	method jwt.SigningMethod
+	priv   interface{}
+	jwk    jwk
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func newRSA(t *testing.T, kid string) signer {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer{kid: kid, method: jwt.SigningMethodRS256, priv: priv, jwk: jwk{
+		Kty: "RSA", Kid: kid, Alg: "RS256", Use: "sig",
+		N: b64(priv.N.Bytes()), E: b64(big.NewInt(int64(priv.E)).Bytes()),
+	}}
+}
+
+func newEC(t *testing.T, kid string) signer {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer{kid: kid, method: jwt.SigningMethodES256, priv: priv, jwk: jwk{
+		Kty: "EC", Kid: kid, Crv: "P-256",
+		X: b64(priv.X.FillBytes(make([]byte, 32))), Y: b64(priv.Y.FillBytes(make([]byte, 32))),
+	}}
+}
+
+func newEd(t *testing.T, kid string) signer {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer{kid: kid, method: jwt.SigningMethodEdDSA, priv: priv, jwk: jwk{
+		Kty: "OKP", Kid: kid, Crv: "Ed25519", X: b64(pub),
+	}}
+}
+
+func (s signer) token(t *testing.T) string {
+	tok := jwt.NewWithClaims(s.method, jwt.MapClaims{"sub": "1"})
+	tok.Header["kid"] = s.kid
+	str, err := tok.SignedString(s.priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return str
+}
+
+func writeSet(t *testing.T, path string, keys ...jwk) {
+	t.Helper()
+	b, err := json.Marshal(document{Keys: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func verify(ks *KeySet, token string) error {
+	_, err := jwt.Parse(token, ks.Keyfunc)
+	return err
+}
+
+func TestKeyfunc(t *testing.T) {
+	rsaKey, ecKey, edKey := newRSA(t, "rsa"), newEC(t, "ec"), newEd(t, "ed")
+	enc := newRSA(t, "enc")
+	enc.jwk.Use = "enc"
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeSet(t, path, rsaKey.jwk, ecKey.jwk, edKey.jwk, enc.jwk)
+	ks, err := New(path, 0, time.Hour, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	noKid := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{})
+	noKidStr, _ := noKid.SignedString(rsaKey.priv)
+	wrongAlg := jwt.NewWithClaims(jwt.SigningMethodRS384, jwt.MapClaims{})
+	wrongAlg.Header["kid"] = "rsa"
+	wrongAlgStr, _ := wrongAlg.SignedString(rsaKey.priv)
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "rsa", token: rsaKey.token(t)},
+		{name: "ec", token: ecKey.token(t)},
+		{name: "ed25519", token: edKey.token(t)},
+		{name: "encryption key is skipped", token: enc.token(t), wantErr: true},
+		{name: "unknown kid", token: newRSA(t, "other").token(t), wantErr: true},
+		{name: "missing kid", token: noKidStr, wantErr: true},
+		{name: "algorithm mismatch", token: wrongAlgStr, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verify(ks, tt.token); (err != nil) != tt.wantErr {
+				t.Errorf("verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRotation(t *testing.T) {
+	oldKey, newKey := newEC(t, "old"), newEC(t, "new")
+	tests := []struct {
+		name     string
+		grace    time.Duration
+		wantOld  bool
+		lastSeen time.Duration
+	}{
+		{name: "within grace", grace: time.Hour, wantOld: true},
+		{name: "no grace", grace: 0, wantOld: false},
+		{name: "grace expired", grace: time.Hour, lastSeen: 2 * time.Hour, wantOld: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "jwks.json")
+			writeSet(t, path, oldKey.jwk)
+			ks, err := New(path, 0, tt.grace, zerolog.Nop())
+			if err != nil {
+				t.Fatal(err)
+			}
+			k := ks.keys["old"]
+			k.lastSeen = k.lastSeen.Add(-tt.lastSeen)
+			ks.keys["old"] = k
+
+			writeSet(t, path, newKey.jwk)
+			if err := ks.refresh(); err != nil {
+				t.Fatal(err)
+			}
+			if err := verify(ks, newKey.token(t)); err != nil {
+				t.Errorf("new key: %v", err)
+			}
+			if err := verify(ks, oldKey.token(t)); (err == nil) != tt.wantOld {
+				t.Errorf("old key error = %v, want valid %v", err, tt.wantOld)
+			}
+		})
+	}
+}
+
+func TestUnknownKidRefetch(t *testing.T) {
+	first, second := newRSA(t, "first"), newRSA(t, "second")
+	keys := []jwk{first.jwk}
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		_ = json.NewEncoder(w).Encode(document{Keys: keys})
+	}))
+	defer srv.Close()
+	ks, err := New(srv.URL, 0, time.Hour, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys = []jwk{first.jwk, second.jwk}
+
+	// A fetch just happened, so an unknown kid must not trigger another.
+	if err := verify(ks, second.token(t)); err == nil {
+		t.Fatal("second key verified before refetch was allowed")
+	}
+	if fetches != 1 {
+		t.Fatalf("fetches = %d, want 1", fetches)
+	}
+	ks.fetchedAt = ks.fetchedAt.Add(-minRefetch)
+	if err := verify(ks, second.token(t)); err != nil {
+		t.Fatalf("second key after refetch: %v", err)
+	}
+	if fetches != 2 {
+		t.Fatalf("fetches = %d, want 2", fetches)
+	}
+}
+
+func TestNewRejectsUnusableSets(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "not json", body: "{"},
+		{name: "no keys", body: `{"keys":[]}`},
+		{name: "only invalid keys", body: `{"keys":[{"kty":"EC","kid":"a","crv":"P-999"},{"kty":"RSA","n":"AQAB","e":"AQAB"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "jwks.json")
+			if err := os.WriteFile(path, []byte(tt.body), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := New(path, 0, time.Hour, zerolog.Nop()); err == nil {
+				t.Error("New() succeeded, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package lockout
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const pruneInterval = time.Minute
+
+// Policy locks a key out once it reaches Threshold failures within Window.
+// The first lockout lasts BaseDelay and every further failure doubles it,
+// up to MaxDelay.
+type Policy struct {
+	Threshold int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	Window    time.Duration
+}
+
+func (p Policy) delay(failures int) time.Duration {
+	if failures < p.Threshold {
+		return 0
+	}
+	d := p.BaseDelay
+	for i := p.Threshold; i < failures && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxDelay)
+}
+
+type entry struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+type tracker struct {
+	policy  Policy
+	entries map[string]*entry
+}
+
+func (t *tracker) current(key string, now time.Time) *entry {
+	e, ok := t.entries[key]
+	if !ok {
+		return nil
+	}
+	if now.Sub(e.lastFailure) > t.policy.Window && now.After(e.lockedUntil) {
+		delete(t.entries, key)
+		return nil
+	}
+	return e
+}
+
+func (t *tracker) fail(key string, now time.Time) time.Time {
+	e := t.current(key, now)
+	if e == nil {
+		e = &entry{}
+		t.entries[key] = e
+	}
+	e.failures++
+	e.lastFailure = now
+	if d := t.policy.delay(e.failures); d > 0 {
+		e.lockedUntil = now.Add(d)
+	}
+	return e.lockedUntil
+}
+
+// Guard tracks failed logins per email and per client IP.
+type Guard struct {
+	mu       sync.Mutex
+	email    *tracker
+	ip       *tracker
+	prunedAt time.Time
+	now      func() time.Time
+}
+
+func NewGuard(email, ip Policy) *Guard {
+	return &Guard{
+		email: &tracker{policy: email, entries: make(map[string]*entry)},
+		ip:    &tracker{policy: ip, entries: make(map[string]*entry)},
+		now:   time.Now,
+	}
+}
+
+// Locked reports whether either the email or the IP is locked out and until when.
+func (g *Guard) Locked(email, ip string) (time.Time, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	var until time.Time
+	for _, e := range []*entry{g.email.current(normalize(email), now), g.ip.current(ip, now)} {
+		if e != nil && e.lockedUntil.After(until) {
+			until = e.lockedUntil
+		}
+	}
+	return until, until.After(now)
+}
+
+// Fail records a failed login and returns the resulting lockout expiry, if any.
+func (g *Guard) Fail(email, ip string) time.Time {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	g.prune(now)
+	until := g.email.fail(normalize(email), now)
+	if ipUntil := g.ip.fail(ip, now); ipUntil.After(until) {
+		until = ipUntil
+	}
+	return until
+}
+
+// Reset clears the failures of email after a successful login. IP failures
+// are left to expire, so that logging into an account of one's own does not
+// lift the lockout of an IP guessing other accounts' passwords.
+func (g *Guard) Reset(email string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.email.entries, normalize(email))
+}
+
+func (g *Guard) prune(now time.Time) {
+	if now.Sub(g.prunedAt) < pruneInterval {
+		return
+	}
+	g.prunedAt = now
+	for _, t := range []*tracker{g.email, g.ip} {
+		for key := range t.entries {
+			t.current(key, now)
+		}
+	}
+}
+
+func normalize(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,126 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDelay(t *testing.T) {
+	p := Policy{Threshold: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: 0},
+		{failures: 2, want: 0},
+		{failures: 3, want: time.Second},
+		{failures: 4, want: 2 * time.Second},
+		{failures: 5, want: 4 * time.Second},
+		{failures: 6, want: 8 * time.Second},
+		{failures: 7, want: 10 * time.Second},
+		{failures: 100, want: 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := p.delay(tt.failures); got != tt.want {
+			t.Errorf("delay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+type action int
+
+const (
+	fail action = iota
+	reset
+	check
+)
+
+type step struct {
+	at         time.Duration
+	action     action
+	email, ip  string
+	wantLocked bool
+	wantUntil  time.Duration
+}
+
+func TestGuard(t *testing.T) {
+	email := Policy{Threshold: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: 10 * time.Minute}
+	ip := Policy{Threshold: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: 10 * time.Minute}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "email locks at its threshold and backs off",
+			steps: []step{
+				{action: fail, email: "a@b.c", ip: "1"},
+				{action: check, email: "a@b.c", ip: "2"},
+				{action: fail, email: "A@b.c ", ip: "2", wantUntil: time.Minute},
+				{action: check, email: "a@b.c", ip: "3", wantLocked: true, wantUntil: time.Minute},
+				{at: time.Minute, action: fail, email: "a@b.c", ip: "3", wantUntil: 3 * time.Minute},
+				{at: 3 * time.Minute, action: check, email: "a@b.c", ip: "4"},
+			},
+		},
+		{
+			name: "ip locks across emails",
+			steps: []step{
+				{action: fail, email: "a@b.c", ip: "1"},
+				{action: fail, email: "d@e.f", ip: "1"},
+				{action: fail, email: "g@h.i", ip: "1", wantUntil: time.Minute},
+				{action: check, email: "j@k.l", ip: "1", wantLocked: true, wantUntil: time.Minute},
+				{action: check, email: "j@k.l", ip: "2"},
+			},
+		},
+		{
+			name: "failures outside the window are forgotten",
+			steps: []step{
+				{action: fail, email: "a@b.c", ip: "1"},
+				{at: 11 * time.Minute, action: fail, email: "a@b.c", ip: "2"},
+				{at: 11 * time.Minute, action: check, email: "a@b.c", ip: "3"},
+			},
+		},
+		{
+			name: "successful login resets the email only",
+			steps: []step{
+				{action: fail, email: "victim@b.c", ip: "1"},
+				{action: fail, email: "other@b.c", ip: "1"},
+				{action: reset, email: "mine@b.c", ip: "1"},
+				{action: fail, email: "victim@b.c", ip: "1", wantUntil: time.Minute},
+				{action: reset, email: "victim@b.c", ip: "2"},
+				{action: check, email: "victim@b.c", ip: "2"},
+				{action: check, email: "victim@b.c", ip: "1", wantLocked: true, wantUntil: time.Minute},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			var now time.Time
+			g := NewGuard(email, ip)
+			g.now = func() time.Time { return now }
+			for i, st := range tt.steps {
+				now = start.Add(st.at)
+				var until time.Time
+				locked := false
+				switch st.action {
+				case fail:
+					until = g.Fail(st.email, st.ip)
+				case reset:
+					g.Reset(st.email)
+					continue
+				case check:
+					until, locked = g.Locked(st.email, st.ip)
+					if locked != st.wantLocked {
+						t.Errorf("step %d: locked = %v, want %v", i, locked, st.wantLocked)
+					}
+				}
+				if st.wantUntil == 0 && until.After(now) {
+					t.Errorf("step %d: locked until %v after start, want unlocked", i, until.Sub(start))
+				}
+				if st.wantUntil != 0 && !until.Equal(start.Add(st.wantUntil)) {
+					t.Errorf("step %d: until = %v after start, want %v", i, until.Sub(start), st.wantUntil)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const unmatchedRoute = "unmatched"
+
+type BuildInfo struct {
+	Version   string
+	Commit    string
+	BuildTime string
+}
+
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	latency         *prometheus.HistogramVec
+	inFlight        *prometheus.GaugeVec
+	upstreamCalls   *prometheus.CounterVec
+	upstreamLatency *prometheus.HistogramVec
+	breakerState    *prometheus.GaugeVec
+}
+
+func New(namespace string, build BuildInfo) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests handled by the gateway.",
+		}, []string{"route", "method", "status"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "HTTP requests currently being handled.",
+		}, []string{"route", "method"}),
+		upstreamCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "upstream_grpc_calls_total",
+			Help:      "Unary gRPC calls made to upstream services.",
+		}, []string{"service", "method", "code"}),
+		upstreamLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "upstream_grpc_call_duration_seconds",
+			Help:      "Latency of unary gRPC calls made to upstream services.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"service", "method", "code"}),
+		breakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "upstream_circuit_breaker_state",
+			Help:      "Circuit breaker state per upstream: 0 closed, 1 half-open, 2 open.",
+		}, []string{"upstream", "method"}),
+	}
+	buildInfo := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "build_info",
+		Help:      "Build information of the running gateway.",
+		ConstLabels: prometheus.Labels{
+			"version":    build.Version,
+			"commit":     build.Commit,
+			"build_time": build.BuildTime,
+		},
+	})
+	buildInfo.Set(1)
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		buildInfo,
+		m.requests,
+		m.latency,
+		m.inFlight,
+		m.upstreamCalls,
+		m.upstreamLatency,
+		m.breakerState,
+	)
+	return m
+}
+
+// SetBreakerState records the circuit state of an upstream. An empty method
+// stands for a breaker shared by all methods.
+func (m *Metrics) SetBreakerState(upstream, method string, state int) {
+	if method == "" {
+		method = "*"
+	}
+	m.breakerState.WithLabelValues(upstream, method).Set(float64(state))
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// Middleware records HTTP metrics labelled by the route template rather than
+// the raw path to keep label cardinality bounded.
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		method := c.Request.Method
+		inFlight := m.inFlight.WithLabelValues(route, method)
+		inFlight.Inc()
+		// Deferred so that a panic recovered further up still releases it.
+		defer inFlight.Dec()
+		start := time.Now()
+
+		c.Next()
+
+		code := strconv.Itoa(c.Writer.Status())
+		m.requests.WithLabelValues(route, method, code).Inc()
+		m.latency.WithLabelValues(route, method, code).Observe(time.Since(start).Seconds())
+	}
+}
+
+func (m *Metrics) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		service, name := splitMethod(method)
+		code := status.Code(err).String()
+		m.upstreamCalls.WithLabelValues(service, name, code).Inc()
+		m.upstreamLatency.WithLabelValues(service, name, code).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+func splitMethod(fullMethod string) (string, string) {
+	service, method, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if !ok {
+		return "unknown", fullMethod
+	}
+	return service, method
+}
@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name     string
+		path     string
+		handler  gin.HandlerFunc
+		wantCode string
+	}{
+		{name: "ok", path: "/users/1", handler: func(c *gin.Context) { c.Status(http.StatusOK) }, wantCode: "200"},
+		// The panic unwinds past the middleware before recovery writes the 500.
+		{name: "panic", path: "/users/1", handler: func(*gin.Context) { panic("boom") }},
+		{name: "unmatched", path: "/missing", handler: func(c *gin.Context) { c.Status(http.StatusOK) }, wantCode: "404"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New("test", BuildInfo{})
+			r := gin.New()
+			r.Use(gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, _ any) {
+				c.AbortWithStatus(http.StatusInternalServerError)
+			}), m.Middleware())
+			r.GET("/users/:id", tt.handler)
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			families, err := m.registry.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			requests := metric(families, "test_http_requests_total")
+			if tt.wantCode == "" && len(requests) != 0 {
+				t.Errorf("requests = %v, want none", requests)
+			}
+			if tt.wantCode != "" && (len(requests) != 1 || label(requests[0], "status") != tt.wantCode) {
+				t.Errorf("requests = %v, want one with status %s", requests, tt.wantCode)
+			}
+			for _, g := range metric(families, "test_http_requests_in_flight") {
+				if v := g.GetGauge().GetValue(); v != 0 {
+					t.Errorf("in flight %s = %v, want 0", label(g, "route"), v)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitMethod(t *testing.T) {
+	tests := []struct {
+		in, service, method string
+	}{
+		{in: "/auth.Auth/Login", service: "auth.Auth", method: "Login"},
+		{in: "auth.Auth/Login", service: "auth.Auth", method: "Login"},
+		{in: "Login", service: "unknown", method: "Login"},
+	}
+	for _, tt := range tests {
+		service, method := splitMethod(tt.in)
+		if service != tt.service || method != tt.method {
+			t.Errorf("splitMethod(%q) = %q, %q, want %q, %q", tt.in, service, method, tt.service, tt.method)
+		}
+	}
+}
+
+func metric(families []*dto.MetricFamily, name string) []*dto.Metric {
+	for _, f := range families {
+		if f.GetName() == name {
+			return f.GetMetric()
+		}
+	}
+	return nil
+}
+
+func label(m *dto.Metric, name string) string {
+	for _, l := range m.GetLabel() {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/vindosVP/snapigw/internal/identity"
+)
+
+const unmatchedRoute = "unmatched"
+
+type upstreamKey struct{}
+
+// upstreamCall is filled in by UpstreamCode for the access log entry.
+type upstreamCall struct {
+	code   codes.Code
+	called bool
+}
+
+// AccessLog writes one structured line per request. Successful responses
+// are logged with probability successSample; errors are always logged.
+func AccessLog(l zerolog.Logger, successSample float64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		call := &upstreamCall{}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), upstreamKey{}, call))
+
+		c.Next()
+
+		status := c.Writer.Status()
+		failed := status >= http.StatusBadRequest || (call.called && call.code != codes.OK)
+		if !failed && successSample < 1 && rand.Float64() >= successSample {
+			return
+		}
+
+		var e *zerolog.Event
+		switch {
+		case status >= http.StatusInternalServerError:
+			e = l.Error()
+		case failed:
+			e = l.Warn()
+		default:
+			e = l.Info()
+		}
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		e = e.Ctx(c.Request.Context()).
+			Str("requestId", c.GetString("requestId")).
+			Str("method", c.Request.Method).
+			Str("route", route).
+			Str("path", c.Request.URL.Path).
+			Int("status", status).
+			Dur("latency", time.Since(start)).
+			Int("bytes", max(c.Writer.Size(), 0)).
+			Str("clientIp", c.ClientIP())
+		if id, ok := identity.From(c); ok {
+			e = e.Str("userId", id.Id).Str("identityKind", id.Kind)
+			if id.Owner != "" {
+				e = e.Str("owner", id.Owner)
+			}
+		}
+		if call.called {
+			e = e.Str("upstreamCode", call.code.String())
+		}
+		if len(c.Errors) > 0 {
+			e = e.Str("errors", c.Errors.String())
+		}
+		e.Msg("request handled")
+	}
+}
+
+// UpstreamCode records the gRPC status of upstream calls made while
+// serving a request so that AccessLog can report it.
+func UpstreamCode() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if call, ok := ctx.Value(upstreamKey{}).(*upstreamCall); ok {
+			call.code = status.Code(err)
+			call.called = true
+		}
+		return err
+	}
+}
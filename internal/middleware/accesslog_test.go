@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAccessLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name         string
+		sample       float64
+		status       int
+		upstreamErr  error
+		callUpstream bool
+		wantLogged   bool
+		wantLevel    string
+		wantUpstream string
+	}{
+		{name: "success", sample: 1, status: http.StatusOK, wantLogged: true, wantLevel: "info"},
+		{name: "success sampled out", sample: 0, status: http.StatusOK},
+		{name: "client error is always logged", sample: 0, status: http.StatusNotFound, wantLogged: true, wantLevel: "warn"},
+		{name: "server error is always logged", sample: 0, status: http.StatusBadGateway, wantLogged: true, wantLevel: "error"},
+		{
+			name:   "upstream success",
+			sample: 1, status: http.StatusOK, callUpstream: true,
+			wantLogged: true, wantLevel: "info", wantUpstream: "OK",
+		},
+		{
+			name:   "upstream success sampled out",
+			sample: 0, status: http.StatusOK, callUpstream: true,
+		},
+		{
+			name:   "upstream failure behind a success status",
+			sample: 0, status: http.StatusOK, callUpstream: true, upstreamErr: status.Error(codes.NotFound, "missing"),
+			wantLogged: true, wantLevel: "warn", wantUpstream: "NotFound",
+		},
+		{
+			name:   "upstream failure with a server error",
+			sample: 1, status: http.StatusServiceUnavailable, callUpstream: true, upstreamErr: status.Error(codes.Unavailable, "down"),
+			wantLogged: true, wantLevel: "error", wantUpstream: "Unavailable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			r := gin.New()
+			r.GET("/users/:id", AccessLog(zerolog.New(buf), tt.sample), func(c *gin.Context) {
+				if tt.callUpstream {
+					invoker := func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+						return tt.upstreamErr
+					}
+					_ = UpstreamCode()(c.Request.Context(), "/auth.Auth/Login", nil, nil, nil, invoker)
+				}
+				c.Status(tt.status)
+			})
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/7", nil))
+
+			if !tt.wantLogged {
+				if buf.Len() > 0 {
+					t.Errorf("logged %s, want nothing", buf)
+				}
+				return
+			}
+			if n := strings.Count(buf.String(), "\n"); n != 1 {
+				t.Fatalf("logged %d lines, want 1: %s", n, buf)
+			}
+			var entry map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatal(err)
+			}
+			if entry["level"] != tt.wantLevel {
+				t.Errorf("level = %v, want %s", entry["level"], tt.wantLevel)
+			}
+			if entry["route"] != "/users/:id" || entry["status"] != float64(tt.status) {
+				t.Errorf("route = %v, status = %v", entry["route"], entry["status"])
+			}
+			got, ok := entry["upstreamCode"]
+			if tt.wantUpstream == "" && ok {
+				t.Errorf("upstreamCode = %v, want it absent", got)
+			}
+			if tt.wantUpstream != "" && got != tt.wantUpstream {
+				t.Errorf("upstreamCode = %v, want %s", got, tt.wantUpstream)
+			}
+		})
+	}
+}
+
+func TestAccessLogUnmatchedRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	buf := &bytes.Buffer{}
+	r := gin.New()
+	r.Use(AccessLog(zerolog.New(buf), 1))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nowhere", nil))
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["route"] != unmatchedRoute {
+		t.Errorf("route = %v, want %s", entry["route"], unmatchedRoute)
+	}
+}
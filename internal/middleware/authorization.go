@@ -2,46 +2,309 @@ package middleware
 
 import (
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/pkg/errors"
 
+	"github.com/vindosVP/snapigw/internal/apikey"
+	"github.com/vindosVP/snapigw/internal/clientcert"
+	"github.com/vindosVP/snapigw/internal/identity"
+	"github.com/vindosVP/snapigw/internal/jwks"
+	"github.com/vindosVP/snapigw/internal/policy"
+	"github.com/vindosVP/snapigw/internal/revocation"
 	"github.com/vindosVP/snapigw/internal/utils/response"
 )
 
+const (
+	CodeInvalidHeader   = "invalid_header"
+	CodeTokenInvalid    = "token_invalid"
+	CodeTokenExpired    = "token_expired"
+	CodeTokenNotYet     = "token_not_yet_valid"
+	CodeInvalidAudience = "token_invalid_audience"
+	CodeInvalidIssuer   = "token_invalid_issuer"
+	CodeTokenRevoked    = "token_revoked"
+	CodeForbidden       = "insufficient_permissions"
+	CodeCertRequired    = "client_certificate_required"
+	CodeCertUnknown     = "client_certificate_unknown"
+	CodeAPIKeyInvalid   = "api_key_invalid"
+	CodeAPIKeyExpired   = "api_key_expired"
+	CodeAPIKeyRevoked   = "api_key_revoked"
+)
+
 type Claims struct {
 	jwt.RegisteredClaims
-	Email   string `json:"email,omitempty"`
-	Id      int    `json:"id"`
-	IsAdmin *bool  `json:"isAdmin,omitempty"`
+	Email   string   `json:"email,omitempty"`
+	Id      int      `json:"id"`
+	IsAdmin *bool    `json:"isAdmin,omitempty"`
+	Roles   []string `json:"roles,omitempty"`
+	// Scope is a space-delimited list of granted scopes (RFC 8693).
+	Scope string `json:"scope,omitempty"`
+}
+
+func (c *Claims) Admin() bool {
+	return c.IsAdmin != nil && *c.IsAdmin
+}
+
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+func (c *Claims) policySubject() policy.Subject {
+	roles := c.Roles
+	if c.Admin() && !slices.Contains(roles, policy.RoleAdmin) {
+		roles = append(slices.Clone(roles), policy.RoleAdmin)
+	}
+	return policy.Subject{Roles: roles, Scopes: c.Scopes()}
+}
+
+// TokenOptions narrows which tokens are accepted. Empty Issuers or Audiences
+// accept any value; a token matches when it carries at least one listed value.
+type TokenOptions struct {
+	Issuers   []string
+	Audiences []string
+	Leeway    time.Duration
+	// Methods lists the accepted authentication methods; empty means jwt only.
+	Methods []string
+}
+
+type tokenError struct {
+	code string
+	msg  string
+}
+
+func (e *tokenError) Error() string {
+	return e.msg
+}
+
+var validMethods = []string{
+	"HS256", "HS384", "HS512",
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+// Keyfunc verifies HMAC tokens with secret and asymmetric tokens with keys
+// from ks. Either may be left empty to reject that family of tokens.
+func Keyfunc(secret string, ks *jwks.KeySet) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		if _, OK := token.Method.(*jwt.SigningMethodHMAC); OK {
+			if secret == "" {
+				return nil, errors.New("bad signed method received")
+			}
+			return []byte(secret), nil
+		}
+		if ks == nil {
+			return nil, errors.New("bad signed method received")
+		}
+		return ks.Keyfunc(token)
+	}
+}
+
+type Authenticator struct {
+	keyfunc  jwt.Keyfunc
+	revoked  revocation.Store
+	services *clientcert.Mapper
+	apiKeys  apikey.Store
+}
+
+func NewAuthenticator(keyfunc jwt.Keyfunc) *Authenticator {
+	return &Authenticator{keyfunc: keyfunc}
+}
+
+func (a *Authenticator) WithRevocation(s revocation.Store) *Authenticator {
+	a.revoked = s
+	return a
+}
+
+// WithServices enables client certificate authentication for the mapped services.
+func (a *Authenticator) WithServices(m *clientcert.Mapper) *Authenticator {
+	a.services = m
+	return a
+}
+
+// WithAPIKeys enables API key authentication against s.
+func (a *Authenticator) WithAPIKeys(s apikey.Store) *Authenticator {
+	a.apiKeys = s
+	return a
 }
 
-func Authorize(secret string, requireAdmin bool) gin.HandlerFunc {
+// Authorize authenticates the caller with the first of opts.Methods whose
+// credentials are present and, when p is not nil, requires the caller to
+// satisfy it.
+func (a *Authenticator) Authorize(opts TokenOptions, p *policy.Policy) gin.HandlerFunc {
+	methods := opts.Methods
+	if len(methods) == 0 {
+		methods = []string{identity.MethodJWT}
+	}
 	return func(c *gin.Context) {
-		jwtToken, err := extractBearerToken(c.GetHeader("Authorization"))
-		if err != nil {
-			response.AbortErr(c, http.StatusUnauthorized, err.Error())
-			return
+		switch selectMethod(c, methods) {
+		case identity.MethodAPIKey:
+			k, ok := a.apiKey(c)
+			if !ok {
+				return
+			}
+			if p != nil && !p.Allows(policy.Subject{Scopes: k.Scopes}) {
+				response.AbortErrCode(c, http.StatusForbidden, CodeForbidden, "You are not authorized for this operation")
+				return
+			}
+			c.Set("apiKeyId", k.Id)
+			c.Set("apiKeyOwner", k.Owner)
+			c.Set("apiKeyTier", k.Tier)
+			c.Set("scopes", k.Scopes)
+			identity.Set(c, &identity.Identity{
+				Kind:   identity.KindAPIKey,
+				Id:     k.Id,
+				Owner:  k.Owner,
+				Scopes: k.Scopes,
+			})
+		case identity.MethodClientCert:
+			name, svc, ok := a.clientCert(c)
+			if !ok {
+				return
+			}
+			if p != nil && !p.Allows(policy.Subject{Roles: svc.Roles, Scopes: svc.Scopes}) {
+				response.AbortErrCode(c, http.StatusForbidden, CodeForbidden, "You are not authorized for this operation")
+				return
+			}
+			c.Set("serviceId", name)
+			c.Set("roles", svc.Roles)
+			c.Set("scopes", svc.Scopes)
+			identity.Set(c, &identity.Identity{
+				Kind:   identity.KindService,
+				Id:     name,
+				Roles:  svc.Roles,
+				Scopes: svc.Scopes,
+			})
+		default:
+			claims, ok := a.bearer(c, opts)
+			if !ok {
+				return
+			}
+			if p != nil && !p.Allows(claims.policySubject()) {
+				response.AbortErrCode(c, http.StatusForbidden, CodeForbidden, "You are not authorized for this operation")
+				return
+			}
+			c.Set("userId", claims.Id)
+			c.Set("tokenId", claims.ID)
+			if claims.ExpiresAt != nil {
+				c.Set("tokenExpiresAt", claims.ExpiresAt.Time)
+			}
+			c.Set("isAdmin", claims.Admin())
+			c.Set("roles", claims.Roles)
+			c.Set("scopes", claims.Scopes())
+			identity.Set(c, &identity.Identity{
+				Kind:   identity.KindUser,
+				Id:     strconv.Itoa(claims.Id),
+				Email:  claims.Email,
+				Admin:  claims.Admin(),
+				Roles:  claims.Roles,
+				Scopes: claims.Scopes(),
+			})
 		}
-		token, err := parseToken(jwtToken, secret)
-		if err != nil {
-			response.AbortErr(c, http.StatusUnauthorized, err.Error())
-			return
+		c.Next()
+	}
+}
+
+// selectMethod picks the first method the request carries credentials for,
+// falling back to the first method so that its error is reported.
+func selectMethod(c *gin.Context, methods []string) string {
+	for _, m := range methods {
+		switch m {
+		case identity.MethodClientCert:
+			if c.Request.TLS != nil && len(c.Request.TLS.PeerCertificates) > 0 {
+				return m
+			}
+		case identity.MethodJWT:
+			if c.GetHeader("Authorization") != "" {
+				return m
+			}
+		case identity.MethodAPIKey:
+			if c.GetHeader(APIKeyHeader) != "" {
+				return m
+			}
 		}
-		claims, OK := token.Claims.(*Claims)
-		if !OK {
-			response.AbortErr(c, http.StatusInternalServerError, err.Error())
-			return
+	}
+	return methods[0]
+}
+
+func (a *Authenticator) bearer(c *gin.Context, opts TokenOptions) (*Claims, bool) {
+	jwtToken, err := extractBearerToken(c.GetHeader("Authorization"))
+	if err != nil {
+		response.AbortErrCode(c, http.StatusUnauthorized, CodeInvalidHeader, err.Error())
+		return nil, false
+	}
+	claims, err := parseToken(jwtToken, a.keyfunc, opts)
+	if err != nil {
+		var te *tokenError
+		if errors.As(err, &te) {
+			response.AbortErrCode(c, http.StatusUnauthorized, te.code, te.msg)
+			return nil, false
 		}
-		if requireAdmin && !*claims.IsAdmin {
-			response.AbortErr(c, http.StatusUnauthorized, "You are not authorized for this operation")
+		response.AbortErrCode(c, http.StatusUnauthorized, CodeTokenInvalid, err.Error())
+		return nil, false
+	}
+	if a.revoked != nil {
+		var issuedAt time.Time
+		if claims.IssuedAt != nil {
+			issuedAt = claims.IssuedAt.Time
 		}
-		c.Set("userId", claims.Id)
-		c.Set("isAdmin", claims.IsAdmin)
-		c.Next()
+		revoked, err := a.revoked.IsRevoked(c, claims.ID, claims.Id, issuedAt)
+		if err != nil {
+			response.AbortErr(c, http.StatusServiceUnavailable, "failed to check token revocation")
+			return nil, false
+		}
+		if revoked {
+			response.AbortErrCode(c, http.StatusUnauthorized, CodeTokenRevoked, "token is revoked")
+			return nil, false
+		}
+	}
+	return claims, true
+}
+
+func (a *Authenticator) apiKey(c *gin.Context) (*apikey.Key, bool) {
+	header := c.GetHeader(APIKeyHeader)
+	if header == "" || a.apiKeys == nil {
+		response.AbortErrCode(c, http.StatusUnauthorized, CodeAPIKeyInvalid, "api key required")
+		return nil, false
+	}
+	k, err := apikey.Verify(c, a.apiKeys, header)
+	switch {
+	case errors.Is(err, apikey.ErrMalformed), errors.Is(err, apikey.ErrNotFound), errors.Is(err, apikey.ErrMismatch):
+		response.AbortErrCode(c, http.StatusUnauthorized, CodeAPIKeyInvalid, "invalid api key")
+		return nil, false
+	case err != nil:
+		response.AbortErr(c, http.StatusServiceUnavailable, "failed to check api key")
+		return nil, false
+	case k.Revoked():
+		response.AbortErrCode(c, http.StatusUnauthorized, CodeAPIKeyRevoked, "api key is revoked")
+		return nil, false
+	case k.Expired(time.Now()):
+		response.AbortErrCode(c, http.StatusUnauthorized, CodeAPIKeyExpired, "api key is expired")
+		return nil, false
+	}
+	return k, true
+}
+
+// clientCert maps the client certificate to a service. The TLS listener
+// rejects certificates that do not chain to the client CA, so any
+// certificate seen here has been verified.
+func (a *Authenticator) clientCert(c *gin.Context) (string, clientcert.Service, bool) {
+	if c.Request.TLS == nil || len(c.Request.TLS.PeerCertificates) == 0 {
+		response.AbortErrCode(c, http.StatusUnauthorized, CodeCertRequired, "client certificate required")
+		return "", clientcert.Service{}, false
+	}
+	name, svc, ok := a.services.Match(c.Request.TLS.PeerCertificates[0])
+	if !ok {
+		response.AbortErrCode(c, http.StatusUnauthorized, CodeCertUnknown, "client certificate is not mapped to a service")
+		return "", clientcert.Service{}, false
 	}
+	return name, svc, true
 }
 
 func extractBearerToken(header string) (string, error) {
@@ -57,17 +320,29 @@ func extractBearerToken(header string) (string, error) {
 	return jwtToken[1], nil
 }
 
-func parseToken(jwtToken string, secret string) (*jwt.Token, error) {
-	token, err := jwt.ParseWithClaims(jwtToken, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, OK := token.Method.(*jwt.SigningMethodHMAC); !OK {
-			return nil, errors.New("bad signed method received")
-		}
-		return []byte(secret), nil
-	})
-
-	if err != nil {
-		return nil, errors.New("bad jwt token")
+func parseToken(jwtToken string, keyfunc jwt.Keyfunc, opts TokenOptions) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(jwtToken, claims, keyfunc,
+		jwt.WithValidMethods(validMethods),
+		jwt.WithLeeway(opts.Leeway),
+	)
+	switch {
+	case err == nil:
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return nil, &tokenError{code: CodeTokenExpired, msg: "token is expired"}
+	case errors.Is(err, jwt.ErrTokenNotValidYet):
+		return nil, &tokenError{code: CodeTokenNotYet, msg: "token is not valid yet"}
+	default:
+		return nil, &tokenError{code: CodeTokenInvalid, msg: "bad jwt token"}
 	}
 
-	return token, nil
+	if len(opts.Issuers) > 0 && !slices.Contains(opts.Issuers, claims.Issuer) {
+		return nil, &tokenError{code: CodeInvalidIssuer, msg: "token has invalid issuer"}
+	}
+	if len(opts.Audiences) > 0 && !slices.ContainsFunc(claims.Audience, func(aud string) bool {
+		return slices.Contains(opts.Audiences, aud)
+	}) {
+		return nil, &tokenError{code: CodeInvalidAudience, msg: "token has invalid audience"}
+	}
+	return claims, nil
 }
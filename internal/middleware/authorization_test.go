@@ -0,0 +1,292 @@
+package middleware
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/vindosVP/snapigw/internal/apikey"
+	"github.com/vindosVP/snapigw/internal/clientcert"
+	"github.com/vindosVP/snapigw/internal/identity"
+	"github.com/vindosVP/snapigw/internal/policy"
+	"github.com/vindosVP/snapigw/internal/revocation"
+)
+
+const secret = "test-secret"
+
+func sign(t *testing.T, claims Claims) string {
+	t.Helper()
+	s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + s
+}
+
+// serve runs one request through Authorize and returns the status, the
+// error code and the identity seen by the handler.
+func serve(a *Authenticator, opts TokenOptions, p *policy.Policy, header http.Header) (int, string, *identity.Identity) {
+	var id *identity.Identity
+	r := gin.New()
+	r.GET("/", a.Authorize(opts, p), func(c *gin.Context) {
+		id, _ = identity.From(c)
+		c.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header = header
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var res struct {
+		Code string `json:"code"`
+	}
+	_ = json.NewDecoder(w.Body).Decode(&res)
+	return w.Code, res.Code, id
+}
+
+func TestAuthorizeJWT(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	now := time.Now()
+	valid := func() Claims {
+		return Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        "jti-1",
+				Issuer:    "https://id.example.com",
+				Audience:  jwt.ClaimStrings{"snapigw"},
+				IssuedAt:  jwt.NewNumericDate(now.Add(-time.Minute)),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			},
+			Id:    7,
+			Scope: "users:ban audit:read",
+		}
+	}
+	opts := TokenOptions{Issuers: []string{"https://id.example.com"}, Audiences: []string{"snapigw", "partners"}, Leeway: 30 * time.Second}
+	isAdmin := true
+	tests := []struct {
+		name string
+		// raw replaces the signed token with header.
+		raw      bool
+		header   string
+		change   func(c *Claims)
+		policy   *policy.Policy
+		want     int
+		wantCode string
+	}{
+		{name: "valid", want: http.StatusOK},
+		{name: "missing header", raw: true, want: http.StatusUnauthorized, wantCode: CodeInvalidHeader},
+		{name: "malformed header", raw: true, header: "Bearer", want: http.StatusUnauthorized, wantCode: CodeInvalidHeader},
+		{name: "garbage token", raw: true, header: "Bearer x.y.z", want: http.StatusUnauthorized, wantCode: CodeTokenInvalid},
+		{name: "other issuer", change: func(c *Claims) { c.Issuer = "https://evil.test" }, want: http.StatusUnauthorized, wantCode: CodeInvalidIssuer},
+		{name: "one matching audience", change: func(c *Claims) { c.Audience = jwt.ClaimStrings{"other", "partners"} }, want: http.StatusOK},
+		{name: "other audience", change: func(c *Claims) { c.Audience = jwt.ClaimStrings{"other"} }, want: http.StatusUnauthorized, wantCode: CodeInvalidAudience},
+		{name: "no audience", change: func(c *Claims) { c.Audience = nil }, want: http.StatusUnauthorized, wantCode: CodeInvalidAudience},
+		{name: "expired within leeway", change: func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-10 * time.Second)) }, want: http.StatusOK},
+		{name: "expired", change: func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute)) }, want: http.StatusUnauthorized, wantCode: CodeTokenExpired},
+		{name: "not yet valid", change: func(c *Claims) { c.NotBefore = jwt.NewNumericDate(now.Add(time.Minute)) }, want: http.StatusUnauthorized, wantCode: CodeTokenNotYet},
+		{name: "scope allowed", policy: &policy.Policy{Scope: "users:ban"}, want: http.StatusOK},
+		{name: "scope missing", policy: &policy.Policy{Scope: "users:admin"}, want: http.StatusForbidden, wantCode: CodeForbidden},
+		{name: "admin flag grants the admin role", change: func(c *Claims) { c.IsAdmin = &isAdmin }, policy: policy.RequireRole(policy.RoleAdmin), want: http.StatusOK},
+		{name: "revoked token", change: func(c *Claims) { c.ID = "revoked" }, want: http.StatusUnauthorized, wantCode: CodeTokenRevoked},
+	}
+	revoked := revocation.NewMemoryStore(time.Hour)
+	if err := revoked.RevokeToken(context.Background(), "revoked", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	a := NewAuthenticator(Keyfunc(secret, nil)).WithRevocation(revoked)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			if tt.change != nil {
+				tt.change(&claims)
+			}
+			header := http.Header{}
+			if !tt.raw {
+				header.Set("Authorization", sign(t, claims))
+			} else if tt.header != "" {
+				header.Set("Authorization", tt.header)
+			}
+			code, errCode, id := serve(a, opts, tt.policy, header)
+			if code != tt.want || errCode != tt.wantCode {
+				t.Fatalf("status = %d %q, want %d %q", code, errCode, tt.want, tt.wantCode)
+			}
+			if code == http.StatusOK && (id == nil || id.Kind != identity.KindUser || id.Id != "7") {
+				t.Errorf("identity = %+v", id)
+			}
+		})
+	}
+}
+
+func TestKeyfunc(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	claims := Claims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}, Id: 1}
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		a     *Authenticator
+		token string
+		want  int
+	}{
+		{name: "hmac", a: NewAuthenticator(Keyfunc(secret, nil)), token: sign(t, claims), want: http.StatusOK},
+		{name: "hmac disabled", a: NewAuthenticator(Keyfunc("", nil)), token: sign(t, claims), want: http.StatusUnauthorized},
+		{name: "wrong key", a: NewAuthenticator(Keyfunc(secret, nil)), token: "Bearer " + otherKey, want: http.StatusUnauthorized},
+		{name: "alg none", a: NewAuthenticator(Keyfunc(secret, nil)), token: "Bearer " + unsigned, want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		header.Set("Authorization", tt.token)
+		if code, _, _ := serve(tt.a, TokenOptions{}, nil, header); code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, code, tt.want)
+		}
+	}
+}
+
+func TestAuthorizeAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+	store := memKeys{}
+	newKey := func(k apikey.Key) string {
+		key, stored, err := apikey.Generate(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store[stored.Id] = stored
+		return key
+	}
+	valid := newKey(apikey.Key{Owner: "acme", Scopes: []string{"users:ban"}, Tier: "partner", ExpiresAt: &future})
+	revoked := newKey(apikey.Key{Owner: "acme", RevokedAt: &past})
+	expired := newKey(apikey.Key{Owner: "acme", ExpiresAt: &past})
+	id, _, _ := apikey.Parse(valid)
+
+	partner := TokenOptions{Methods: []string{identity.MethodAPIKey, identity.MethodJWT}}
+	jwtOnly := TokenOptions{}
+	tests := []struct {
+		name     string
+		opts     TokenOptions
+		key      string
+		bearer   bool
+		policy   *policy.Policy
+		want     int
+		wantCode string
+		wantKind string
+	}{
+		{name: "valid", opts: partner, key: valid, want: http.StatusOK, wantKind: identity.KindAPIKey},
+		{name: "scope allowed", opts: partner, key: valid, policy: &policy.Policy{Scope: "users:ban"}, want: http.StatusOK, wantKind: identity.KindAPIKey},
+		{name: "scope missing", opts: partner, key: valid, policy: &policy.Policy{Scope: "users:admin"}, want: http.StatusForbidden, wantCode: CodeForbidden},
+		{name: "revoked", opts: partner, key: revoked, want: http.StatusUnauthorized, wantCode: CodeAPIKeyRevoked},
+		{name: "expired", opts: partner, key: expired, want: http.StatusUnauthorized, wantCode: CodeAPIKeyExpired},
+		{name: "wrong secret", opts: partner, key: valid + "x", want: http.StatusUnauthorized, wantCode: CodeAPIKeyInvalid},
+		{name: "malformed", opts: partner, key: "secret", want: http.StatusUnauthorized, wantCode: CodeAPIKeyInvalid},
+		{name: "no credentials reports the first method", opts: partner, want: http.StatusUnauthorized, wantCode: CodeAPIKeyInvalid},
+		{name: "bearer in a group that accepts both", opts: partner, bearer: true, want: http.StatusOK, wantKind: identity.KindUser},
+		{name: "key in a jwt-only group", opts: jwtOnly, key: valid, want: http.StatusUnauthorized, wantCode: CodeInvalidHeader},
+	}
+	a := NewAuthenticator(Keyfunc(secret, nil)).WithAPIKeys(store)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.key != "" {
+				header.Set(APIKeyHeader, tt.key)
+			}
+			if tt.bearer {
+				header.Set("Authorization", sign(t, Claims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(future)}, Id: 7}))
+			}
+			code, errCode, got := serve(a, tt.opts, tt.policy, header)
+			if code != tt.want || errCode != tt.wantCode {
+				t.Fatalf("status = %d %q, want %d %q", code, errCode, tt.want, tt.wantCode)
+			}
+			if tt.wantKind != "" && (got == nil || got.Kind != tt.wantKind) {
+				t.Fatalf("identity = %+v, want kind %q", got, tt.wantKind)
+			}
+			if tt.wantKind == identity.KindAPIKey && (got.Id != id || got.Owner != "acme") {
+				t.Errorf("identity = %+v, want key %s", got, id)
+			}
+		})
+	}
+
+	t.Run("without a store", func(t *testing.T) {
+		header := http.Header{}
+		header.Set(APIKeyHeader, valid)
+		if code, errCode, _ := serve(NewAuthenticator(Keyfunc(secret, nil)), partner, nil, header); code != http.StatusUnauthorized || errCode != CodeAPIKeyInvalid {
+			t.Errorf("status = %d %q", code, errCode)
+		}
+	})
+}
+
+func TestAuthorizeClientCert(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	a := NewAuthenticator(Keyfunc(secret, nil)).WithServices(clientcert.NewMapper(map[string]clientcert.Service{
+		"moderation": {CommonNames: []string{"moderation"}, Scopes: []string{"users:ban"}},
+	}))
+	opts := TokenOptions{Methods: []string{identity.MethodJWT, identity.MethodClientCert}}
+	tests := []struct {
+		name     string
+		cn       string
+		policy   *policy.Policy
+		want     int
+		wantCode string
+	}{
+		{name: "mapped service", cn: "moderation", policy: &policy.Policy{Scope: "users:ban"}, want: http.StatusOK},
+		{name: "scope missing", cn: "moderation", policy: &policy.Policy{Scope: "users:admin"}, want: http.StatusForbidden, wantCode: CodeForbidden},
+		{name: "unknown certificate", cn: "billing", want: http.StatusUnauthorized, wantCode: CodeCertUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *identity.Identity
+			r := gin.New()
+			r.GET("/", a.Authorize(opts, tt.policy), func(c *gin.Context) {
+				got, _ = identity.From(c)
+				c.Status(http.StatusOK)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: tt.cn}}}}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want || !strings.Contains(w.Body.String(), tt.wantCode) {
+				t.Fatalf("status = %d %s, want %d %q", w.Code, w.Body, tt.want, tt.wantCode)
+			}
+			if tt.want == http.StatusOK && (got == nil || got.Kind != identity.KindService || got.Id != "moderation") {
+				t.Errorf("identity = %+v", got)
+			}
+		})
+	}
+}
+
+type memKeys map[string]apikey.Key
+
+func (s memKeys) Create(_ context.Context, k apikey.Key) error {
+	s[k.Id] = k
+	return nil
+}
+
+func (s memKeys) Get(_ context.Context, id string) (*apikey.Key, error) {
+	k, ok := s[id]
+	if !ok {
+		return nil, apikey.ErrNotFound
+	}
+	return &k, nil
+}
+
+func (s memKeys) List(context.Context) ([]apikey.Key, error) {
+	return nil, nil
+}
+
+func (s memKeys) Revoke(context.Context, string, time.Time) error {
+	return nil
+}
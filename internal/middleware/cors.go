@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/vindosVP/snapigw/internal/cors"
+)
+
+// CORS sets the cross-origin response headers for requests to a route. It
+// runs first in the chain so that rejections stay readable by browsers.
+func CORS(p *cors.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p.Apply(c.Writer.Header(), c.GetHeader("Origin"))
+		c.Next()
+	}
+}
+
+// Preflight answers OPTIONS requests for a path. policies holds the
+// cross-origin policy of every method registered on the path, so that a
+// preflight is judged by the route it asks about; nil policies deny.
+func Preflight(policies map[string]*cors.Policy) gin.HandlerFunc {
+	allow := make([]string, 0, len(policies)+1)
+	for m := range policies {
+		allow = append(allow, m)
+	}
+	allow = append(allow, http.MethodOptions)
+	sort.Strings(allow)
+	return func(c *gin.Context) {
+		method := c.GetHeader("Access-Control-Request-Method")
+		if method != "" {
+			if p := policies[strings.ToUpper(method)]; p != nil {
+				p.ApplyPreflight(c.Writer.Header(), c.GetHeader("Origin"), strings.ToUpper(method))
+			}
+		}
+		c.Header("Allow", strings.Join(allow, ", "))
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
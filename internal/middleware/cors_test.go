@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/vindosVP/snapigw/internal/cors"
+)
+
+func TestPreflight(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	partner := &cors.Policy{AllowOrigins: []string{"https://*.example.com"}, AllowMethods: []string{http.MethodPost}}
+	r := gin.New()
+	r.OPTIONS("/keys", Preflight(map[string]*cors.Policy{
+		http.MethodPost:   partner,
+		http.MethodDelete: nil,
+	}))
+	tests := []struct {
+		name       string
+		origin     string
+		method     string
+		wantOrigin string
+	}{
+		{name: "allowed method and origin", origin: "https://a.example.com", method: "post", wantOrigin: "https://a.example.com"},
+		{name: "method without a policy", origin: "https://a.example.com", method: http.MethodDelete},
+		{name: "method not registered", origin: "https://a.example.com", method: http.MethodGet},
+		{name: "origin not allowed", origin: "https://evil.test", method: http.MethodPost},
+		{name: "plain options request", origin: "https://a.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodOptions, "/keys", nil)
+			set(req, "Origin", tt.origin)
+			set(req, "Access-Control-Request-Method", tt.method)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusNoContent {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusNoContent)
+			}
+			if got := w.Header().Get("Allow"); got != "DELETE, OPTIONS, POST" {
+				t.Errorf("Allow = %q", got)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+		})
+	}
+}
+
+func TestCORS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", CORS(&cors.Policy{AllowOrigins: []string{"https://a.example.com"}}), func(c *gin.Context) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Origin", "https://a.example.com")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://a.example.com" {
+		t.Errorf("rejected response Allow-Origin = %q", got)
+	}
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+
+	"github.com/vindosVP/snapigw/internal/identity"
+	"github.com/vindosVP/snapigw/internal/ratelimit"
+	"github.com/vindosVP/snapigw/internal/utils/response"
+)
+
+const (
+	APIKeyHeader = "X-API-Key"
+
+	CodeRateLimited = "rate_limited"
+)
+
+// RateLimit throttles requests to a route identified by scope. Callers
+// without the configured key (no identity or verified API key) are limited
+// by IP. Store failures let the request through.
+func RateLimit(store ratelimit.Store, scope string, l ratelimit.Limit, lg zerolog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit(c, store, scope+":"+rateLimitKey(c, l.Key), l, lg)
+	}
+}
+
+// TierRateLimit throttles API key callers by the limit of their key's tier,
+// shared across all routes. Keys without a known tier get defaultTier. Other
+// callers pass through.
+func TierRateLimit(store ratelimit.Store, tiers map[string]ratelimit.Limit, defaultTier string, lg zerolog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetString("apiKeyId")
+		if id == "" {
+			c.Next()
+			return
+		}
+		l, ok := tiers[c.GetString("apiKeyTier")]
+		if !ok {
+			l, ok = tiers[defaultTier]
+		}
+		if !ok {
+			c.Next()
+			return
+		}
+		limit(c, store, "tier:"+id, l, lg)
+	}
+}
+
+func limit(c *gin.Context, store ratelimit.Store, key string, l ratelimit.Limit, lg zerolog.Logger) {
+	res, err := store.Allow(c, key, l)
+	if err != nil {
+		lg.Error().Err(err).Str("requestId", c.GetString("requestId")).Msg("failed to check rate limit")
+		c.Next()
+		return
+	}
+	c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	c.Header("RateLimit-Reset", seconds(res.Reset))
+	if !res.Allowed {
+		c.Header("Retry-After", seconds(res.RetryAfter))
+		response.AbortErrCode(c, http.StatusTooManyRequests, CodeRateLimited, "too many requests")
+		return
+	}
+	c.Next()
+}
+
+func rateLimitKey(c *gin.Context, kind string) string {
+	switch kind {
+	case ratelimit.KeyUser:
+		if id, ok := identity.From(c); ok {
+			return "user:" + id.Kind + ":" + id.Id
+		}
+	case ratelimit.KeyAPIKey:
+		if id := c.GetString("apiKeyId"); id != "" {
+			return "apikey:" + id
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
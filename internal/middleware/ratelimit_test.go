@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+
+	"github.com/vindosVP/snapigw/internal/identity"
+	"github.com/vindosVP/snapigw/internal/ratelimit"
+)
+
+type request struct {
+	forwardedFor string
+	apiKey       string
+	apiKeyId     string
+	userId       string
+	want         int
+}
+
+func TestRateLimitKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name     string
+		key      string
+		trusted  []string
+		requests []request
+	}{
+		{
+			name: "forged forwarding headers are ignored",
+			key:  ratelimit.KeyIP,
+			requests: []request{
+				{forwardedFor: "203.0.113.1", want: http.StatusOK},
+				{forwardedFor: "203.0.113.2", want: http.StatusTooManyRequests},
+			},
+		},
+		{
+			name:    "trusted proxies name the client",
+			key:     ratelimit.KeyIP,
+			trusted: []string{"192.0.2.0/24"},
+			requests: []request{
+				{forwardedFor: "203.0.113.1", want: http.StatusOK},
+				{forwardedFor: "203.0.113.2", want: http.StatusOK},
+				{forwardedFor: "203.0.113.1", want: http.StatusTooManyRequests},
+			},
+		},
+		{
+			name: "unverified api keys fall back to the ip",
+			key:  ratelimit.KeyAPIKey,
+			requests: []request{
+				{apiKey: "sgw_a_x", want: http.StatusOK},
+				{apiKey: "sgw_b_y", want: http.StatusTooManyRequests},
+			},
+		},
+		{
+			name: "verified api keys have their own buckets",
+			key:  ratelimit.KeyAPIKey,
+			requests: []request{
+				{apiKeyId: "a", want: http.StatusOK},
+				{apiKeyId: "b", want: http.StatusOK},
+				{apiKeyId: "a", want: http.StatusTooManyRequests},
+			},
+		},
+		{
+			name: "users have their own buckets",
+			key:  ratelimit.KeyUser,
+			requests: []request{
+				{userId: "1", want: http.StatusOK},
+				{userId: "2", want: http.StatusOK},
+				{userId: "1", want: http.StatusTooManyRequests},
+				{want: http.StatusOK},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			if err := r.SetTrustedProxies(tt.trusted); err != nil {
+				t.Fatal(err)
+			}
+			l := ratelimit.Limit{Algorithm: ratelimit.SlidingWindow, Requests: 1, Window: time.Hour, Key: tt.key}
+			r.GET("/", authenticate, RateLimit(ratelimit.NewMemoryStore(), "GET /", l, zerolog.Nop()), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			for i, rq := range tt.requests {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				set(req, "X-Forwarded-For", rq.forwardedFor)
+				set(req, APIKeyHeader, rq.apiKey)
+				set(req, "Test-Api-Key-Id", rq.apiKeyId)
+				set(req, "Test-User-Id", rq.userId)
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				if w.Code != rq.want {
+					t.Errorf("request %d: status = %d, want %d", i, w.Code, rq.want)
+				}
+			}
+		})
+	}
+}
+
+func TestTierRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tiers := map[string]ratelimit.Limit{
+		"tiny":    {Algorithm: ratelimit.SlidingWindow, Requests: 1, Window: time.Hour, Key: ratelimit.KeyAPIKey},
+		"default": {Algorithm: ratelimit.SlidingWindow, Requests: 2, Window: time.Hour, Key: ratelimit.KeyAPIKey},
+	}
+	r := gin.New()
+	r.GET("/", func(c *gin.Context) {
+		c.Set("apiKeyId", c.GetHeader("Test-Api-Key-Id"))
+		c.Set("apiKeyTier", c.GetHeader("Test-Tier"))
+	}, TierRateLimit(ratelimit.NewMemoryStore(), tiers, "default", zerolog.Nop()), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	tests := []struct {
+		id, tier string
+		want     int
+	}{
+		{id: "a", tier: "tiny", want: http.StatusOK},
+		{id: "a", tier: "tiny", want: http.StatusTooManyRequests},
+		{id: "b", tier: "tiny", want: http.StatusOK},
+		{id: "c", want: http.StatusOK},
+		{id: "c", want: http.StatusOK},
+		{id: "c", want: http.StatusTooManyRequests},
+		{id: "d", tier: "removed", want: http.StatusOK},
+		{id: "d", tier: "removed", want: http.StatusOK},
+		{id: "d", tier: "removed", want: http.StatusTooManyRequests},
+		{want: http.StatusOK},
+		{want: http.StatusOK},
+		{want: http.StatusOK},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Test-Api-Key-Id", tt.id)
+		req.Header.Set("Test-Tier", tt.tier)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("request %d: status = %d, want %d", i, w.Code, tt.want)
+		}
+	}
+}
+
+// authenticate stands in for Authorize, taking the verified caller from test headers.
+func authenticate(c *gin.Context) {
+	if id := c.GetHeader("Test-Api-Key-Id"); id != "" {
+		c.Set("apiKeyId", id)
+	}
+	if id := c.GetHeader("Test-User-Id"); id != "" {
+		identity.Set(c, &identity.Identity{Kind: identity.KindUser, Id: id})
+	}
+}
+
+func set(req *http.Request, key, value string) {
+	if value != "" {
+		req.Header.Set(key, value)
+	}
+}
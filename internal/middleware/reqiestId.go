@@ -5,9 +5,37 @@ import (
 	"github.com/google/uuid"
 )
 
-func RequestId() gin.HandlerFunc {
+const (
+	RequestIdHeader = "X-Request-ID"
+
+	maxRequestIdLen = 128
+)
+
+// RequestId takes the request id from the inbound header when it is a
+// reasonable token, generates one otherwise, and echoes it to the client.
+func RequestId(header string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Set("requestId", uuid.New().String())
+		reqId := c.GetHeader(header)
+		if !validRequestId(reqId) {
+			reqId = uuid.New().String()
+		}
+		c.Set("requestId", reqId)
+		c.Header(RequestIdHeader, reqId)
 		c.Next()
 	}
 }
+
+func validRequestId(id string) bool {
+	if id == "" || len(id) > maxRequestIdLen {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':', r == '/', r == '+', r == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
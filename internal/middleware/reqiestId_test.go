@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestValidRequestId(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		want bool
+	}{
+		{name: "uuid", id: "0b4f5a4e-7d3c-4a2b-9c1d-2e3f4a5b6c7d", want: true},
+		{name: "trace style", id: "gw-1:abc/def+x=_.y", want: true},
+		{name: "longest allowed", id: strings.Repeat("a", maxRequestIdLen), want: true},
+		{name: "empty"},
+		{name: "oversized", id: strings.Repeat("a", maxRequestIdLen+1)},
+		{name: "newline", id: "abc\nInjected: 1"},
+		{name: "carriage return", id: "abc\r"},
+		{name: "nul", id: "abc\x00"},
+		{name: "escape sequence", id: "\x1b[31mred"},
+		{name: "space", id: "abc def"},
+		{name: "quote", id: `abc"def`},
+		{name: "non ascii", id: "идентификатор"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validRequestId(tt.id); got != tt.want {
+				t.Errorf("validRequestId(%q) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestId(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name    string
+		header  string
+		inbound string
+		want    string
+	}{
+		{name: "valid id is kept", header: RequestIdHeader, inbound: "abc-123", want: "abc-123"},
+		{name: "custom header", header: "X-Correlation-Id", inbound: "abc-123", want: "abc-123"},
+		{name: "missing id is generated", header: RequestIdHeader},
+		{name: "oversized id is replaced", header: RequestIdHeader, inbound: strings.Repeat("a", maxRequestIdLen+1)},
+		{name: "control characters are replaced", header: RequestIdHeader, inbound: "abc\x1b[0m"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			r := gin.New()
+			r.GET("/", RequestId(tt.header), func(c *gin.Context) {
+				seen = c.GetString("requestId")
+			})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.inbound != "" {
+				req.Header.Set(tt.header, tt.inbound)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if tt.want != "" && seen != tt.want {
+				t.Errorf("requestId = %q, want %q", seen, tt.want)
+			}
+			if tt.want == "" {
+				if _, err := uuid.Parse(seen); err != nil {
+					t.Errorf("requestId = %q, want a generated uuid", seen)
+				}
+			}
+			if got := w.Header().Get(RequestIdHeader); got != seen {
+				t.Errorf("response %s = %q, want %q", RequestIdHeader, got, seen)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package policy
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Policy is a tree of requirements on the caller. Each node sets exactly one
+// of Role, Scope, Authenticated, AllOf or AnyOf:
+//
+//	anyOf:
+//	  - role: admin
+//	  - allOf:
+//	      - scope: users:ban
+//	      - scope: users:admin
+type Policy struct {
+	Role  string   `yaml:"role"`
+	Scope string   `yaml:"scope"`
+	AllOf []Policy `yaml:"allOf"`
+	AnyOf []Policy `yaml:"anyOf"`
+	// Authenticated admits any authenticated caller, for routes such as
+	// logout that every user may call under deny-by-default.
+	Authenticated bool `yaml:"authenticated"`
+
+	deny bool
+}
+
+// RoleAdmin is granted to tokens carrying the legacy isAdmin claim.
+const RoleAdmin = "admin"
+
+type Subject struct {
+	Roles  []string
+	Scopes []string
+}
+
+// Deny matches no subject. It guards authenticated routes that declare
+// no policy when deny-by-default is enabled.
+func Deny() *Policy {
+	return &Policy{deny: true}
+}
+
+func RequireRole(role string) *Policy {
+	return &Policy{Role: role}
+}
+
+// All combines policies so that each of them must hold. Nil policies are skipped.
+func All(ps ...*Policy) *Policy {
+	var all []Policy
+	for _, p := range ps {
+		if p != nil {
+			all = append(all, *p)
+		}
+	}
+	switch len(all) {
+	case 0:
+		return nil
+	case 1:
+		return &all[0]
+	}
+	return &Policy{AllOf: all}
+}
+
+func (p *Policy) Allows(s Subject) bool {
+	switch {
+	case p.deny:
+		return false
+	case p.Role != "":
+		return slices.Contains(s.Roles, p.Role)
+	case p.Scope != "":
+		return slices.Contains(s.Scopes, p.Scope)
+	case p.Authenticated:
+		return true
+	case p.AllOf != nil:
+		for i := range p.AllOf {
+			if !p.AllOf[i].Allows(s) {
+				return false
+			}
+		}
+		return true
+	case p.AnyOf != nil:
+		for i := range p.AnyOf {
+			if p.AnyOf[i].Allows(s) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+func (p *Policy) Validate() error {
+	set := 0
+	for _, ok := range []bool{p.Role != "", p.Scope != "", p.Authenticated, len(p.AllOf) > 0, len(p.AnyOf) > 0} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("policy node must set exactly one of role, scope, authenticated, allOf or anyOf")
+	}
+	for i := range p.AllOf {
+		if err := p.AllOf[i].Validate(); err != nil {
+			return err
+		}
+	}
+	for i := range p.AnyOf {
+		if err := p.AnyOf[i].Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
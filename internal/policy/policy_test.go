@@ -0,0 +1,107 @@
+package policy
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func parse(t *testing.T, src string) *Policy {
+	t.Helper()
+	p := &Policy{}
+	if err := yaml.Unmarshal([]byte(src), p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestAllows(t *testing.T) {
+	banOrAdmin := `
+anyOf:
+  - role: admin
+  - allOf:
+      - scope: users:ban
+      - scope: users:read
+`
+	tests := []struct {
+		name    string
+		policy  string
+		subject Subject
+		want    bool
+	}{
+		{name: "role match", policy: "role: admin", subject: Subject{Roles: []string{"user", "admin"}}, want: true},
+		{name: "role missing", policy: "role: admin", subject: Subject{Roles: []string{"user"}}},
+		{name: "role is not a scope", policy: "role: admin", subject: Subject{Scopes: []string{"admin"}}},
+		{name: "scope match", policy: "scope: users:ban", subject: Subject{Scopes: []string{"users:ban"}}, want: true},
+		{name: "scope missing", policy: "scope: users:ban", subject: Subject{Scopes: []string{"users:read"}}},
+		{name: "authenticated", policy: "authenticated: true", subject: Subject{}, want: true},
+		{name: "anyOf first branch", policy: banOrAdmin, subject: Subject{Roles: []string{"admin"}}, want: true},
+		{name: "anyOf nested allOf", policy: banOrAdmin, subject: Subject{Scopes: []string{"users:read", "users:ban"}}, want: true},
+		{name: "anyOf nested allOf partial", policy: banOrAdmin, subject: Subject{Scopes: []string{"users:ban"}}},
+		{name: "anyOf nothing", policy: banOrAdmin, subject: Subject{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parse(t, tt.policy)
+			if err := p.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			if got := p.Allows(tt.subject); got != tt.want {
+				t.Errorf("Allows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr bool
+	}{
+		{name: "role", policy: "role: admin"},
+		{name: "empty node", policy: "{}", wantErr: true},
+		{name: "two requirements", policy: "{role: admin, scope: users:ban}", wantErr: true},
+		{name: "empty anyOf", policy: "anyOf: []", wantErr: true},
+		{name: "invalid nested node", policy: "allOf: [{role: admin}, {}]", wantErr: true},
+		{name: "authenticated false", policy: "authenticated: false", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := parse(t, tt.policy).Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCombinators(t *testing.T) {
+	admin := Subject{Roles: []string{RoleAdmin}, Scopes: []string{"users:ban"}}
+	tests := []struct {
+		name    string
+		policy  *Policy
+		subject Subject
+		want    bool
+		wantNil bool
+	}{
+		{name: "all of nothing", policy: All(nil, nil), wantNil: true},
+		{name: "all of one", policy: All(nil, RequireRole(RoleAdmin)), subject: admin, want: true},
+		{name: "all of two", policy: All(RequireRole(RoleAdmin), &Policy{Scope: "users:ban"}), subject: admin, want: true},
+		{name: "all of two partial", policy: All(RequireRole(RoleAdmin), &Policy{Scope: "users:delete"}), subject: admin},
+		{name: "deny", policy: Deny(), subject: admin},
+		{name: "deny inside all", policy: All(RequireRole(RoleAdmin), Deny()), subject: admin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantNil {
+				if tt.policy != nil {
+					t.Fatalf("policy = %+v, want nil", tt.policy)
+				}
+				return
+			}
+			if got := tt.policy.Allows(tt.subject); got != tt.want {
+				t.Errorf("Allows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
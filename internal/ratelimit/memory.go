@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+const pruneInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	refill time.Duration
+}
+
+type counter struct {
+	start  time.Time
+	prev   int
+	cur    int
+	window time.Duration
+}
+
+type MemoryStore struct {
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	counters map[string]*counter
+	prunedAt time.Time
+	now      func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:  make(map[string]*bucket),
+		counters: make(map[string]*counter),
+		now:      time.Now,
+	}
+}
+
+func (s *MemoryStore) Allow(_ context.Context, key string, l Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.prune(now)
+	if l.Algorithm == SlidingWindow {
+		return s.slidingWindow(now, key, l), nil
+	}
+	return s.tokenBucket(now, key, l), nil
+}
+
+func (s *MemoryStore) tokenBucket(now time.Time, key string, l Limit) Result {
+	capacity := l.capacity()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now, refill: l.refill()}
+		s.buckets[key] = b
+	}
+	elapsed := float64(now.Sub(b.last)) / float64(time.Millisecond)
+	b.tokens = math.Min(capacity, b.tokens+elapsed*l.rate())
+	b.last = now
+	if b.tokens < 1 {
+		return bucketResult(l, b.tokens, false)
+	}
+	b.tokens--
+	return bucketResult(l, b.tokens, true)
+}
+
+func (s *MemoryStore) slidingWindow(now time.Time, key string, l Limit) Result {
+	start := now.Truncate(l.Window)
+	c, ok := s.counters[key]
+	if !ok {
+		c = &counter{start: start, window: l.Window}
+		s.counters[key] = c
+	}
+	switch {
+	case start.Equal(c.start):
+	case start.Sub(c.start) == l.Window:
+		c.prev, c.cur, c.start = c.cur, 0, start
+	default:
+		c.prev, c.cur, c.start = 0, 0, start
+	}
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(l.Window)
+	if int(math.Ceil(float64(c.prev)*weight))+c.cur >= l.Requests {
+		return windowResult(l, c.prev, c.cur, elapsed, false)
+	}
+	c.cur++
+	return windowResult(l, c.prev, c.cur, elapsed, true)
+}
+
+func (s *MemoryStore) prune(now time.Time) {
+	if now.Sub(s.prunedAt) < pruneInterval {
+		return
+	}
+	s.prunedAt = now
+	for k, b := range s.buckets {
+		// Only full buckets can be dropped; others would come back full.
+		if now.Sub(b.last) > b.refill {
+			delete(s.buckets, k)
+		}
+	}
+	for k, c := range s.counters {
+		if now.Sub(c.start) > 2*c.window {
+			delete(s.counters, k)
+		}
+	}
+}
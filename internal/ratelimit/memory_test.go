@@ -0,0 +1,192 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type step struct {
+	at          time.Duration
+	allowed     bool
+	remaining   int
+	retryAfter  time.Duration
+	differentIP bool
+}
+
+func run(t *testing.T, l Limit, steps []step) {
+	t.Helper()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var now time.Time
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	for i, st := range steps {
+		now = start.Add(st.at)
+		key := "a"
+		if st.differentIP {
+			key = "b"
+		}
+		res, err := s.Allow(context.Background(), key, l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Allowed != st.allowed || res.Remaining != st.remaining || res.RetryAfter != st.retryAfter {
+			t.Errorf("step %d at %v: got allowed=%v remaining=%d retryAfter=%v, want allowed=%v remaining=%d retryAfter=%v",
+				i, st.at, res.Allowed, res.Remaining, res.RetryAfter, st.allowed, st.remaining, st.retryAfter)
+		}
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit Limit
+		steps []step
+	}{
+		{
+			name:  "capacity defaults to requests",
+			limit: Limit{Algorithm: TokenBucket, Requests: 2, Window: 2 * time.Second},
+			steps: []step{
+				{allowed: true, remaining: 1},
+				{allowed: true, remaining: 0},
+				{allowed: false, remaining: 0, retryAfter: time.Second},
+				{at: 500 * time.Millisecond, allowed: false, remaining: 0, retryAfter: 500 * time.Millisecond},
+				{at: time.Second, allowed: true, remaining: 0},
+			},
+		},
+		{
+			name:  "burst above the sustained rate",
+			limit: Limit{Algorithm: TokenBucket, Requests: 1, Window: time.Second, Burst: 3},
+			steps: []step{
+				{allowed: true, remaining: 2},
+				{allowed: true, remaining: 1},
+				{allowed: true, remaining: 0},
+				{allowed: false, remaining: 0, retryAfter: time.Second},
+				{at: 10 * time.Second, allowed: true, remaining: 2},
+			},
+		},
+		{
+			name:  "keys are independent",
+			limit: Limit{Algorithm: TokenBucket, Requests: 1, Window: time.Minute},
+			steps: []step{
+				{allowed: true, remaining: 0},
+				{allowed: false, remaining: 0, retryAfter: time.Minute},
+				{allowed: true, remaining: 0, differentIP: true},
+			},
+		},
+		{
+			name:  "idle buckets are kept until they are full",
+			limit: Limit{Algorithm: TokenBucket, Requests: 1, Window: time.Second, Burst: 3},
+			steps: []step{
+				{allowed: true, remaining: 2, differentIP: true},
+				{at: 58 * time.Second, allowed: true, remaining: 2},
+				{at: 58 * time.Second, allowed: true, remaining: 1},
+				{at: 58 * time.Second, allowed: true, remaining: 0},
+				// Pruning runs here; the bucket has refilled only two tokens.
+				{at: 60 * time.Second, allowed: true, remaining: 1},
+				{at: 60 * time.Second, allowed: true, remaining: 0},
+				{at: 60 * time.Second, allowed: false, remaining: 0, retryAfter: time.Second},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run(t, tt.limit, tt.steps)
+		})
+	}
+}
+
+func TestTokenBucketRefillsWithinAMillisecond(t *testing.T) {
+	// One token every 100µs, with no room to save any up.
+	l := Limit{Algorithm: TokenBucket, Requests: 10000, Window: time.Second, Burst: 1}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	var allowed int
+	for i := 0; i < 1000; i++ {
+		now = start.Add(time.Duration(i) * 50 * time.Microsecond)
+		res, err := s.Allow(context.Background(), "a", l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Allowed {
+			allowed++
+		}
+	}
+	// 50ms at one token per 100µs, plus the initial token.
+	if allowed != 500 {
+		t.Errorf("allowed %d of 1000 calls 50µs apart, want 500", allowed)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit Limit
+		steps []step
+	}{
+		{
+			name:  "fills the current window",
+			limit: Limit{Algorithm: SlidingWindow, Requests: 2, Window: time.Minute},
+			steps: []step{
+				{allowed: true, remaining: 1},
+				{at: 10 * time.Second, allowed: true, remaining: 0},
+				{at: 20 * time.Second, allowed: false, remaining: 0, retryAfter: 40 * time.Second},
+			},
+		},
+		{
+			name:  "previous window weighs in by overlap",
+			limit: Limit{Algorithm: SlidingWindow, Requests: 4, Window: time.Minute},
+			steps: []step{
+				{allowed: true, remaining: 3},
+				{allowed: true, remaining: 2},
+				{allowed: true, remaining: 1},
+				{allowed: true, remaining: 0},
+				// A quarter into the next window 3 of the previous 4 still count.
+				{at: 75 * time.Second, allowed: true, remaining: 0},
+				{at: 75 * time.Second, allowed: false, remaining: 0, retryAfter: 15 * time.Second},
+				{at: 90 * time.Second, allowed: true, remaining: 0},
+			},
+		},
+		{
+			name:  "an idle window resets the count",
+			limit: Limit{Algorithm: SlidingWindow, Requests: 1, Window: time.Minute},
+			steps: []step{
+				{allowed: true, remaining: 0},
+				{at: 150 * time.Second, allowed: true, remaining: 0},
+				{at: 150 * time.Second, allowed: false, remaining: 0, retryAfter: 30 * time.Second},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run(t, tt.limit, tt.steps)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := Limit{Algorithm: TokenBucket, Requests: 1, Window: time.Second, Key: KeyIP}
+	tests := []struct {
+		name    string
+		mutate  func(l *Limit)
+		wantErr bool
+	}{
+		{name: "valid", mutate: func(*Limit) {}},
+		{name: "unknown algorithm", mutate: func(l *Limit) { l.Algorithm = "leaky" }, wantErr: true},
+		{name: "unknown key", mutate: func(l *Limit) { l.Key = "header" }, wantErr: true},
+		{name: "no requests", mutate: func(l *Limit) { l.Requests = 0 }, wantErr: true},
+		{name: "no window", mutate: func(l *Limit) { l.Window = 0 }, wantErr: true},
+		{name: "negative burst", mutate: func(l *Limit) { l.Burst = -1 }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := valid
+			tt.mutate(&l)
+			if err := l.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	TokenBucket   = "token_bucket"
+	SlidingWindow = "sliding_window"
+)
+
+const (
+	KeyIP     = "ip"
+	KeyUser   = "user"
+	KeyAPIKey = "apikey"
+)
+
+// Limit allows Requests per Window. Token buckets may additionally burst up
+// to Burst requests; it defaults to Requests.
+type Limit struct {
+	Algorithm string        `yaml:"algorithm"`
+	Requests  int           `yaml:"requests"`
+	Window    time.Duration `yaml:"window"`
+	Burst     int           `yaml:"burst"`
+	Key       string        `yaml:"key"`
+}
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+type Store interface {
+	Allow(ctx context.Context, key string, l Limit) (Result, error)
+}
+
+func (l Limit) Validate() error {
+	switch l.Algorithm {
+	case TokenBucket, SlidingWindow:
+	default:
+		return fmt.Errorf("unknown rate limit algorithm %q", l.Algorithm)
+	}
+	switch l.Key {
+	case KeyIP, KeyUser, KeyAPIKey:
+	default:
+		return fmt.Errorf("unknown rate limit key %q", l.Key)
+	}
+	if l.Requests <= 0 {
+		return fmt.Errorf("rate limit requests must be positive")
+	}
+	if l.Window <= 0 {
+		return fmt.Errorf("rate limit window must be positive")
+	}
+	if l.Burst < 0 {
+		return fmt.Errorf("rate limit burst must not be negative")
+	}
+	return nil
+}
+
+func (l Limit) capacity() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Requests)
+}
+
+// rate is the token refill rate per millisecond.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / float64(l.Window.Milliseconds())
+}
+
+// refill is how long an empty bucket takes to fill up, after which an idle
+// bucket is indistinguishable from a new one.
+func (l Limit) refill() time.Duration {
+	return millis(l.capacity() / l.rate())
+}
+
+func bucketResult(l Limit, tokens float64, allowed bool) Result {
+	capacity, rate := l.capacity(), l.rate()
+	res := Result{
+		Allowed:   allowed,
+		Limit:     int(capacity),
+		Remaining: int(math.Floor(tokens)),
+		Reset:     millis((capacity - tokens) / rate),
+	}
+	if !allowed {
+		res.RetryAfter = millis((1 - tokens) / rate)
+	}
+	return res
+}
+
+// windowResult estimates usage as the current window count plus the previous
+// window count weighted by how much of it still overlaps the sliding window.
+func windowResult(l Limit, prev, cur int, elapsed time.Duration, allowed bool) Result {
+	window := l.Window
+	weight := 1 - float64(elapsed)/float64(window)
+	used := int(math.Ceil(float64(prev)*weight)) + cur
+	res := Result{
+		Allowed:   allowed,
+		Limit:     l.Requests,
+		Remaining: max(l.Requests-used, 0),
+		Reset:     window - elapsed,
+	}
+	if allowed {
+		return res
+	}
+	res.RetryAfter = window - elapsed
+	// One more request fits once the weighted previous count drops to
+	// Requests-cur-1.
+	if cur < l.Requests && prev > 0 {
+		wait := time.Duration(float64(window)*(1-float64(l.Requests-cur-1)/float64(prev))) - elapsed
+		if wait > 0 && wait < res.RetryAfter {
+			res.RetryAfter = wait
+		}
+	}
+	return res
+}
+
+func millis(ms float64) time.Duration {
+	return time.Duration(math.Ceil(ms)) * time.Millisecond
+}
@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+const keyPrefix = "ratelimit:"
+
+// tokenBucket refills and takes a token atomically. Tokens are returned as a
+// string to keep their fractional part.
+var tokenBucket = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+local state = redis.call("HMGET", KEYS[1], "tokens", "last")
+local tokens = tonumber(state[1]) or capacity
+local last = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - last) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "last", now)
+redis.call("PEXPIRE", KEYS[1], ttl)
+return {allowed, tostring(tokens)}
+`)
+
+// slidingWindow counts requests in fixed windows keyed by their start and
+// weights the previous window by its remaining overlap.
+var slidingWindow = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local elapsed = tonumber(ARGV[3])
+local prev = tonumber(redis.call("GET", KEYS[2]) or "0")
+local cur = tonumber(redis.call("GET", KEYS[1]) or "0")
+if math.ceil(prev * (1 - elapsed / window)) + cur >= limit then
+	return {0, prev, cur}
+end
+cur = redis.call("INCR", KEYS[1])
+redis.call("PEXPIRE", KEYS[1], window * 2)
+return {1, prev, cur}
+`)
+
+type RedisStore struct {
+	rdb *redis.Client
+}
+
+func NewRedisStore(rdb *redis.Client) *RedisStore {
+	return &RedisStore{rdb: rdb}
+}
+
+func (s *RedisStore) Allow(ctx context.Context, key string, l Limit) (Result, error) {
+	now := time.Now()
+	if l.Algorithm == SlidingWindow {
+		return s.slidingWindow(ctx, now, key, l)
+	}
+	return s.tokenBucket(ctx, now, key, l)
+}
+
+func (s *RedisStore) tokenBucket(ctx context.Context, now time.Time, key string, l Limit) (Result, error) {
+	res, err := tokenBucket.Run(ctx, s.rdb, []string{keyPrefix + "{" + key + "}"},
+		l.capacity(), l.rate(), now.UnixMilli(), l.refill().Milliseconds()).Slice()
+	if err != nil {
+		return Result{}, errors.Wrap(err, "failed to run token bucket")
+	}
+	if len(res) != 2 {
+		return Result{}, errors.New("unexpected token bucket reply")
+	}
+	allowed, _ := res[0].(int64)
+	raw, _ := res[1].(string)
+	tokens, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return Result{}, errors.Wrap(err, "unexpected token bucket reply")
+	}
+	return bucketResult(l, tokens, allowed == 1), nil
+}
+
+func (s *RedisStore) slidingWindow(ctx context.Context, now time.Time, key string, l Limit) (Result, error) {
+	start := now.Truncate(l.Window)
+	// The hash tag keeps both windows in one cluster slot.
+	base := keyPrefix + "{" + key + "}:"
+	cur := base + strconv.FormatInt(start.UnixMilli(), 10)
+	prev := base + strconv.FormatInt(start.Add(-l.Window).UnixMilli(), 10)
+	elapsed := now.Sub(start)
+	res, err := slidingWindow.Run(ctx, s.rdb, []string{cur, prev},
+		l.Requests, l.Window.Milliseconds(), elapsed.Milliseconds()).Int64Slice()
+	if err != nil {
+		return Result{}, errors.Wrap(err, "failed to run sliding window")
+	}
+	if len(res) != 3 {
+		return Result{}, errors.New("unexpected sliding window reply")
+	}
+	return windowResult(l, int(res[1]), int(res[2]), elapsed, res[0] == 1), nil
+}
@@ -0,0 +1,95 @@
+package revocation
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const pruneInterval = time.Minute
+
+type userEntry struct {
+	before    time.Time
+	expiresAt time.Time
+}
+
+type MemoryStore struct {
+	mu       sync.RWMutex
+	ttl      time.Duration
+	tokens   map[string]time.Time
+	users    map[int]userEntry
+	prunedAt time.Time
+}
+
+// NewMemoryStore keeps user revocations for ttl, which should be at least
+// the lifetime of an access token.
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		ttl:    ttl,
+		tokens: make(map[string]time.Time),
+		users:  make(map[int]userEntry),
+	}
+}
+
+func (s *MemoryStore) RevokeToken(_ context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+	s.tokens[jti] = expiresAt
+	return nil
+}
+
+func (s *MemoryStore) ClaimToken(_ context.Context, jti string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+	if exp, ok := s.tokens[jti]; ok && time.Now().Before(exp) {
+		return false, nil
+	}
+	s.tokens[jti] = expiresAt
+	return true, nil
+}
+
+func (s *MemoryStore) RevokeUser(_ context.Context, userId int, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+	if e, ok := s.users[userId]; ok && e.before.After(before) {
+		return nil
+	}
+	s.users[userId] = userEntry{before: before, expiresAt: before.Add(s.ttl)}
+	return nil
+}
+
+func (s *MemoryStore) IsRevoked(_ context.Context, jti string, userId int, issuedAt time.Time) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := time.Now()
+	if jti != "" {
+		if exp, ok := s.tokens[jti]; ok && now.Before(exp) {
+			return true, nil
+		}
+	}
+	if e, ok := s.users[userId]; ok && now.Before(e.expiresAt) {
+		return issuedAt.IsZero() || issuedAt.Before(e.before), nil
+	}
+	return false, nil
+}
+
+func (s *MemoryStore) prune() {
+	now := time.Now()
+	if now.Sub(s.prunedAt) < pruneInterval {
+		return
+	}
+	s.prunedAt = now
+	for jti, exp := range s.tokens {
+		if !now.Before(exp) {
+			delete(s.tokens, jti)
+		}
+	}
+	for id, e := range s.users {
+		if !now.Before(e.expiresAt) {
+			delete(s.users, id)
+		}
+	}
+}
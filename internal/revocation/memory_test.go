@@ -0,0 +1,142 @@
+package revocation
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	tests := []struct {
+		name     string
+		revoke   func(s *MemoryStore)
+		jti      string
+		userId   int
+		issuedAt time.Time
+		want     bool
+	}{
+		{
+			name:   "nothing revoked",
+			revoke: func(*MemoryStore) {},
+			jti:    "a", userId: 1, issuedAt: now,
+		},
+		{
+			name:   "revoked token",
+			revoke: func(s *MemoryStore) { _ = s.RevokeToken(ctx, "a", now.Add(time.Hour)) },
+			jti:    "a", userId: 1, issuedAt: now,
+			want: true,
+		},
+		{
+			name:   "other token",
+			revoke: func(s *MemoryStore) { _ = s.RevokeToken(ctx, "a", now.Add(time.Hour)) },
+			jti:    "b", userId: 1, issuedAt: now,
+		},
+		{
+			name:   "revoked token past expiry",
+			revoke: func(s *MemoryStore) { _ = s.RevokeToken(ctx, "a", now.Add(-time.Second)) },
+			jti:    "a", userId: 1, issuedAt: now,
+		},
+		{
+			name:   "token issued before user revocation",
+			revoke: func(s *MemoryStore) { _ = s.RevokeUser(ctx, 1, now) },
+			jti:    "a", userId: 1, issuedAt: now.Add(-time.Minute),
+			want: true,
+		},
+		{
+			name:   "token issued after user revocation",
+			revoke: func(s *MemoryStore) { _ = s.RevokeUser(ctx, 1, now) },
+			jti:    "a", userId: 1, issuedAt: now.Add(time.Minute),
+		},
+		{
+			name:   "token without issue time",
+			revoke: func(s *MemoryStore) { _ = s.RevokeUser(ctx, 1, now) },
+			jti:    "a", userId: 1,
+			want: true,
+		},
+		{
+			name:   "other user",
+			revoke: func(s *MemoryStore) { _ = s.RevokeUser(ctx, 1, now) },
+			jti:    "a", userId: 2, issuedAt: now.Add(-time.Minute),
+		},
+		{
+			name: "user revocation only moves forward",
+			revoke: func(s *MemoryStore) {
+				_ = s.RevokeUser(ctx, 1, now)
+				_ = s.RevokeUser(ctx, 1, now.Add(-time.Hour))
+			},
+			jti: "a", userId: 1, issuedAt: now.Add(-time.Minute),
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemoryStore(time.Hour)
+			tt.revoke(s)
+			got, err := s.IsRevoked(ctx, tt.jti, tt.userId, tt.issuedAt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("IsRevoked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreUserRevocationExpires(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(time.Minute)
+	if err := s.RevokeUser(ctx, 1, time.Now().Add(-2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.IsRevoked(ctx, "", 1, time.Now().Add(-3*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got {
+		t.Error("IsRevoked() = true after the revocation ttl passed")
+	}
+}
+
+func TestMemoryStoreClaimToken(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	tests := []struct {
+		name   string
+		revoke func(s *MemoryStore)
+		want   bool
+	}{
+		{name: "unused token", revoke: func(*MemoryStore) {}, want: true},
+		{
+			name:   "claimed token",
+			revoke: func(s *MemoryStore) { _, _ = s.ClaimToken(ctx, "a", now.Add(time.Hour)) },
+		},
+		{
+			name:   "revoked token",
+			revoke: func(s *MemoryStore) { _ = s.RevokeToken(ctx, "a", now.Add(time.Hour)) },
+		},
+		{
+			name:   "revocation past expiry",
+			revoke: func(s *MemoryStore) { _ = s.RevokeToken(ctx, "a", now.Add(-time.Second)) },
+			want:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemoryStore(time.Hour)
+			tt.revoke(s)
+			got, err := s.ClaimToken(ctx, "a", now.Add(time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ClaimToken() = %v, want %v", got, tt.want)
+			}
+			if revoked, _ := s.IsRevoked(ctx, "a", 1, now); !revoked {
+				t.Error("token is not revoked after ClaimToken()")
+			}
+		})
+	}
+}
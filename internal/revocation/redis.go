@@ -0,0 +1,88 @@
+package revocation
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	tokenPrefix = "revoked:jti:"
+	userPrefix  = "revoked:user:"
+)
+
+// revokeUser only moves the revoked-before mark forward.
+var revokeUser = redis.NewScript(`
+local cur = tonumber(redis.call("GET", KEYS[1]) or "0")
+if tonumber(ARGV[1]) > cur then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+end
+return 1
+`)
+
+type RedisStore struct {
+	rdb *redis.Client
+	ttl time.Duration
+}
+
+func NewRedisStore(rdb *redis.Client, ttl time.Duration) *RedisStore {
+	return &RedisStore{rdb: rdb, ttl: ttl}
+}
+
+func (s *RedisStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	if err := s.rdb.Set(ctx, tokenPrefix+jti, 1, ttl).Err(); err != nil {
+		return errors.Wrap(err, "failed to revoke token")
+	}
+	return nil
+}
+
+func (s *RedisStore) ClaimToken(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return true, nil
+	}
+	ok, err := s.rdb.SetNX(ctx, tokenPrefix+jti, 1, ttl).Result()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to claim token")
+	}
+	return ok, nil
+}
+
+func (s *RedisStore) RevokeUser(ctx context.Context, userId int, before time.Time) error {
+	key := userPrefix + strconv.Itoa(userId)
+	err := revokeUser.Run(ctx, s.rdb, []string{key}, before.UnixNano(), s.ttl.Milliseconds()).Err()
+	if err != nil {
+		return errors.Wrap(err, "failed to revoke user tokens")
+	}
+	return nil
+}
+
+func (s *RedisStore) IsRevoked(ctx context.Context, jti string, userId int, issuedAt time.Time) (bool, error) {
+	pipe := s.rdb.Pipeline()
+	var tokenCmd *redis.IntCmd
+	if jti != "" {
+		tokenCmd = pipe.Exists(ctx, tokenPrefix+jti)
+	}
+	userCmd := pipe.Get(ctx, userPrefix+strconv.Itoa(userId))
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return false, errors.Wrap(err, "failed to check revocation")
+	}
+	if tokenCmd != nil && tokenCmd.Val() > 0 {
+		return true, nil
+	}
+	before, err := userCmd.Int64()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "failed to check revocation")
+	}
+	return issuedAt.IsZero() || issuedAt.UnixNano() < before, nil
+}
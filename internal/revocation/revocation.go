@@ -0,0 +1,17 @@
+package revocation
+
+import (
+	"context"
+	"time"
+)
+
+// Store records revoked access tokens. Tokens are revoked one by one by jti,
+// or all at once for a user by rejecting tokens issued before a given moment.
+type Store interface {
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	// ClaimToken revokes the token unless it already is, and reports whether
+	// this call was the one to revoke it.
+	ClaimToken(ctx context.Context, jti string, expiresAt time.Time) (bool, error)
+	RevokeUser(ctx context.Context, userId int, before time.Time) error
+	IsRevoked(ctx context.Context, jti string, userId int, issuedAt time.Time) (bool, error)
+}
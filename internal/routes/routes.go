@@ -0,0 +1,234 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/vindosVP/snapigw/internal/clientcert"
+	"github.com/vindosVP/snapigw/internal/cors"
+	"github.com/vindosVP/snapigw/internal/identity"
+	"github.com/vindosVP/snapigw/internal/policy"
+	"github.com/vindosVP/snapigw/internal/ratelimit"
+	"github.com/vindosVP/snapigw/internal/upstream"
+)
+
+// DefaultGroup applies to routes that do not name a group.
+const DefaultGroup = "default"
+
+type Table struct {
+	// DenyByDefault rejects authenticated routes that declare neither
+	// admin nor a policy.
+	DenyByDefault bool             `yaml:"denyByDefault"`
+	Groups        map[string]Group `yaml:"groups"`
+	Routes        []Route          `yaml:"routes"`
+	// Upstreams holds call policies keyed by upstream name.
+	Upstreams map[string]upstream.Config `yaml:"upstreams"`
+	// Services maps client certificates to machine identities.
+	Services map[string]clientcert.Service `yaml:"services"`
+	// APIKeyTiers are the rate limits that API keys can be assigned to.
+	APIKeyTiers map[string]ratelimit.Limit `yaml:"apiKeyTiers"`
+	// DefaultAPIKeyTier limits keys that were created without a tier. It is
+	// required once tiers are declared.
+	DefaultAPIKeyTier string `yaml:"defaultApiKeyTier"`
+	// APIKeyScopes may be granted to new API keys by any key administrator.
+	APIKeyScopes []string `yaml:"apiKeyScopes"`
+	// CORS is the cross-origin policy for groups that do not set their own.
+	CORS *cors.Policy `yaml:"cors"`
+}
+
+// Group holds settings shared by the routes that reference it.
+type Group struct {
+	Issuers   []string      `yaml:"issuers"`
+	Audiences []string      `yaml:"audiences"`
+	Leeway    time.Duration `yaml:"leeway"`
+	// AuthMethods lists how callers of authenticated routes may prove their
+	// identity. It defaults to jwt.
+	AuthMethods []string `yaml:"authMethods"`
+	// CORS replaces the table-wide cross-origin policy for the group.
+	CORS *cors.Policy `yaml:"cors"`
+}
+
+type Route struct {
+	Path      string            `yaml:"path"`
+	Method    string            `yaml:"method"`
+	Upstream  string            `yaml:"upstream"`
+	Group     string            `yaml:"group"`
+	Handler   string            `yaml:"handler"`
+	RPC       string            `yaml:"rpc"`
+	Params    map[string]string `yaml:"params"`
+	Auth      bool              `yaml:"auth"`
+	Admin     bool              `yaml:"admin"`
+	Policy    *policy.Policy    `yaml:"policy"`
+	RateLimit *ratelimit.Limit  `yaml:"rateLimit"`
+	Timeout   time.Duration     `yaml:"timeout"`
+}
+
+var methods = map[string]struct{}{
+	http.MethodGet:     {},
+	http.MethodHead:    {},
+	http.MethodPost:    {},
+	http.MethodPut:     {},
+	http.MethodPatch:   {},
+	http.MethodDelete:  {},
+	http.MethodOptions: {},
+}
+
+// Load reads the route table from path. JSON is a subset of YAML,
+// so both formats are accepted regardless of the file extension.
+func Load(path string) (*Table, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read routes file")
+	}
+	return Parse(b)
+}
+
+func Parse(b []byte) (*Table, error) {
+	t := &Table{}
+	if err := yaml.Unmarshal(b, t); err != nil {
+		return nil, errors.Wrap(err, "failed to parse routes")
+	}
+	if err := t.validate(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *Table) Group(r Route) Group {
+	if r.Group == "" {
+		return t.Groups[DefaultGroup]
+	}
+	return t.Groups[r.Group]
+}
+
+func (t *Table) Upstream(name string) upstream.Config {
+	return t.Upstreams[name]
+}
+
+// CORSPolicy returns the cross-origin policy for r, or nil when
+// cross-origin requests are not allowed.
+func (t *Table) CORSPolicy(r Route) *cors.Policy {
+	if g := t.Group(r); g.CORS != nil {
+		return g.CORS
+	}
+	return t.CORS
+}
+
+// Policy returns the authorization policy for r, folding the admin flag into it.
+func (t *Table) Policy(r Route) *policy.Policy {
+	if !r.Auth {
+		return nil
+	}
+	var admin *policy.Policy
+	if r.Admin {
+		admin = policy.RequireRole(policy.RoleAdmin)
+	}
+	p := policy.All(admin, r.Policy)
+	if p == nil && t.DenyByDefault {
+		return policy.Deny()
+	}
+	return p
+}
+
+func (t *Table) validate() error {
+	if t.CORS != nil {
+		if err := t.CORS.Validate(); err != nil {
+			return err
+		}
+	}
+	for name, g := range t.Groups {
+		if g.Leeway < 0 {
+			return fmt.Errorf("group %s: leeway must not be negative", name)
+		}
+		for _, m := range g.AuthMethods {
+			switch m {
+			case identity.MethodJWT, identity.MethodClientCert, identity.MethodAPIKey:
+			default:
+				return fmt.Errorf("group %s: unknown auth method %q", name, m)
+			}
+		}
+		if g.CORS != nil {
+			if err := g.CORS.Validate(); err != nil {
+				return fmt.Errorf("group %s: %w", name, err)
+			}
+		}
+	}
+	for name, u := range t.Upstreams {
+		if err := u.Validate(); err != nil {
+			return fmt.Errorf("upstream %s: %w", name, err)
+		}
+	}
+	for name, l := range t.APIKeyTiers {
+		if l.Key == "" {
+			l.Key = ratelimit.KeyAPIKey
+			t.APIKeyTiers[name] = l
+		}
+		if err := l.Validate(); err != nil {
+			return fmt.Errorf("api key tier %s: %w", name, err)
+		}
+	}
+	if _, ok := t.APIKeyTiers[t.DefaultAPIKeyTier]; !ok && (len(t.APIKeyTiers) > 0 || t.DefaultAPIKeyTier != "") {
+		return fmt.Errorf("default api key tier %q is not declared", t.DefaultAPIKeyTier)
+	}
+	for _, s := range t.APIKeyScopes {
+		if s == "" {
+			return fmt.Errorf("api key scopes must not be empty")
+		}
+	}
+	for name, s := range t.Services {
+		if err := s.Validate(); err != nil {
+			return fmt.Errorf("service %s: %w", name, err)
+		}
+	}
+	seen := make(map[string]struct{}, len(t.Routes))
+	for i := range t.Routes {
+		r := &t.Routes[i]
+		r.Method = strings.ToUpper(r.Method)
+		if r.Path == "" || !strings.HasPrefix(r.Path, "/") {
+			return fmt.Errorf("route %d: path must start with /", i)
+		}
+		if _, ok := methods[r.Method]; !ok {
+			return fmt.Errorf("route %s: unsupported method %q", r.Path, r.Method)
+		}
+		if r.Upstream == "" {
+			return fmt.Errorf("route %s %s: upstream is required", r.Method, r.Path)
+		}
+		if _, ok := t.Groups[r.Group]; r.Group != "" && !ok {
+			return fmt.Errorf("route %s %s: unknown group %q", r.Method, r.Path, r.Group)
+		}
+		if (r.Handler == "") == (r.RPC == "") {
+			return fmt.Errorf("route %s %s: exactly one of handler or rpc is required", r.Method, r.Path)
+		}
+		if r.Admin && !r.Auth {
+			return fmt.Errorf("route %s %s: admin requires auth", r.Method, r.Path)
+		}
+		if r.Policy != nil {
+			if !r.Auth {
+				return fmt.Errorf("route %s %s: policy requires auth", r.Method, r.Path)
+			}
+			if err := r.Policy.Validate(); err != nil {
+				return fmt.Errorf("route %s %s: %w", r.Method, r.Path, err)
+			}
+		}
+		if r.RateLimit != nil {
+			if err := r.RateLimit.Validate(); err != nil {
+				return fmt.Errorf("route %s %s: %w", r.Method, r.Path, err)
+			}
+		}
+		if r.Timeout < 0 {
+			return fmt.Errorf("route %s %s: timeout must not be negative", r.Method, r.Path)
+		}
+		key := r.Method + " " + r.Path
+		if _, ok := seen[key]; ok {
+			return fmt.Errorf("route %s: declared more than once", key)
+		}
+		seen[key] = struct{}{}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package routes
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/vindosVP/snapigw/internal/identity"
+	"github.com/vindosVP/snapigw/internal/policy"
+)
+
+func TestLoadShippedTable(t *testing.T) {
+	table, err := Load("../../config/routes.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range table.Routes {
+		if table.Policy(r) == nil && r.Auth {
+			t.Errorf("route %s %s is authenticated without a policy", r.Method, r.Path)
+		}
+	}
+	if len(table.APIKeyScopes) > 0 {
+		t.Errorf("api key scopes = %v, want none granted by default", table.APIKeyScopes)
+	}
+	partner := Route{Group: "partner"}
+	g := table.Group(partner)
+	if !slices.Contains(g.AuthMethods, identity.MethodAPIKey) {
+		t.Errorf("partner group auth methods = %v, want api_key", g.AuthMethods)
+	}
+	if cp := table.CORSPolicy(partner); cp == nil || !slices.Contains(cp.AllowHeaders, "X-API-Key") {
+		t.Error("partner group does not allow the X-API-Key header cross-origin")
+	}
+	if _, ok := table.APIKeyTiers[table.DefaultAPIKeyTier]; !ok {
+		t.Errorf("default api key tier %q is not declared", table.DefaultAPIKeyTier)
+	}
+}
+
+const route = `
+routes:
+  - path: /a
+    method: post
+    upstream: auth
+    handler: h
+`
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{name: "minimal", yaml: route},
+		{name: "missing path", yaml: "routes: [{method: GET, upstream: a, handler: h}]", wantErr: "path must start with /"},
+		{name: "unsupported method", yaml: "routes: [{path: /a, method: TRACE, upstream: a, handler: h}]", wantErr: "unsupported method"},
+		{name: "missing upstream", yaml: "routes: [{path: /a, method: GET, handler: h}]", wantErr: "upstream is required"},
+		{name: "handler and rpc", yaml: "routes: [{path: /a, method: GET, upstream: a, handler: h, rpc: s/M}]", wantErr: "exactly one of handler or rpc"},
+		{name: "unknown group", yaml: "routes: [{path: /a, method: GET, upstream: a, handler: h, group: g}]", wantErr: "unknown group"},
+		{name: "admin without auth", yaml: "routes: [{path: /a, method: GET, upstream: a, handler: h, admin: true}]", wantErr: "admin requires auth"},
+		{name: "policy without auth", yaml: "routes: [{path: /a, method: GET, upstream: a, handler: h, policy: {role: x}}]", wantErr: "policy requires auth"},
+		{name: "duplicate", yaml: route + route[len("routes:\n"):], wantErr: "declared more than once"},
+		{name: "unknown auth method", yaml: "groups: {g: {authMethods: [basic]}}", wantErr: "unknown auth method"},
+		{name: "negative leeway", yaml: "groups: {g: {leeway: -1s}}", wantErr: "leeway must not be negative"},
+		{
+			name:    "tiers without a default",
+			yaml:    "apiKeyTiers: {standard: {algorithm: token_bucket, requests: 1, window: 1m}}",
+			wantErr: "default api key tier",
+		},
+		{
+			name:    "undeclared default tier",
+			yaml:    "defaultApiKeyTier: gold\napiKeyTiers: {standard: {algorithm: token_bucket, requests: 1, window: 1m}}",
+			wantErr: "default api key tier",
+		},
+		{name: "default tier without tiers", yaml: "defaultApiKeyTier: gold", wantErr: "default api key tier"},
+		{
+			name: "default tier",
+			yaml: "defaultApiKeyTier: standard\napiKeyTiers: {standard: {algorithm: token_bucket, requests: 1, window: 1m}}",
+		},
+		{name: "empty api key scope", yaml: `apiKeyScopes: [""]`, wantErr: "api key scopes must not be empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.yaml))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Parse() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Parse() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	table, err := Parse([]byte("denyByDefault: true\n" + route))
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := policy.Subject{Roles: []string{policy.RoleAdmin}}
+	tests := []struct {
+		name  string
+		route Route
+		want  func(p *policy.Policy) bool
+	}{
+		{name: "public", route: Route{}, want: func(p *policy.Policy) bool { return p == nil }},
+		{name: "denied by default", route: Route{Auth: true}, want: func(p *policy.Policy) bool { return !p.Allows(admin) }},
+		{name: "admin", route: Route{Auth: true, Admin: true}, want: func(p *policy.Policy) bool {
+			return p.Allows(admin) && !p.Allows(policy.Subject{})
+		}},
+	}
+	for _, tt := range tests {
+		if p := table.Policy(tt.route); !tt.want(p) {
+			t.Errorf("%s: unexpected policy %+v", tt.name, p)
+		}
+	}
+}
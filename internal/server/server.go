@@ -2,26 +2,61 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
 
+	"github.com/vindosVP/snapigw/internal/cors"
+	"github.com/vindosVP/snapigw/internal/health"
+	"github.com/vindosVP/snapigw/internal/identity"
+	"github.com/vindosVP/snapigw/internal/metrics"
 	"github.com/vindosVP/snapigw/internal/middleware"
-	"github.com/vindosVP/snapigw/internal/services/auth"
+	"github.com/vindosVP/snapigw/internal/ratelimit"
+	"github.com/vindosVP/snapigw/internal/routes"
+	"github.com/vindosVP/snapigw/internal/tracing"
+	"github.com/vindosVP/snapigw/internal/transcode"
 )
 
 type Server struct {
-	l      zerolog.Logger
-	port   int
-	router *gin.Engine
-	proxs  *Proxs
+	l         zerolog.Logger
+	port      int
+	adminPort int
+	admin     *http.ServeMux
+	router    *gin.Engine
+	metrics   *metrics.Metrics
+	tracing   string
+	health    *health.Health
+
+	requestIdHeader string
+	accessLogSample float64
+	proxs           *Proxs
+	transcoder      *transcode.Transcoder
+	limiter         ratelimit.Store
+	trustedProxies  []string
+
+	tls          *tls.Config
+	h2c          bool
+	redirectPort int
+
+	preStopDelay time.Duration
+	drainTimeout time.Duration
+	inFlight     atomic.Int64
 }
 
 func (s *Server) WithProxs(proxs *Proxs) *Server {
@@ -29,66 +64,364 @@ func (s *Server) WithProxs(proxs *Proxs) *Server {
 	return s
 }
 
-func (s *Server) Run() {
+// WithAdmin serves operational endpoints such as /metrics on a separate port.
+func (s *Server) WithAdmin(port int) *Server {
+	s.adminPort = port
+	return s
+}
+
+func (s *Server) HandleAdmin(pattern string, h http.Handler) {
+	s.admin.Handle(pattern, h)
+}
+
+// WithHealth serves /healthz and /readyz on the admin port. Readiness checks
+// every gRPC upstream and fails as soon as shutdown begins.
+func (s *Server) WithHealth(h *health.Health) *Server {
+	s.health = h
+	s.HandleAdmin("/healthz", h.LivenessHandler())
+	s.HandleAdmin("/readyz", h.ReadinessHandler())
+	return s
+}
+
+func (s *Server) WithMetrics(m *metrics.Metrics) *Server {
+	s.metrics = m
+	s.HandleAdmin("/metrics", m.Handler())
+	return s
+}
+
+// WithRequestIdHeader sets the inbound header trusted to carry a request id.
+func (s *Server) WithRequestIdHeader(header string) *Server {
+	s.requestIdHeader = header
+	return s
+}
+
+// WithAccessLogSample sets the share of successful requests that are logged.
+func (s *Server) WithAccessLogSample(sample float64) *Server {
+	s.accessLogSample = sample
+	return s
+}
+
+// WithTracing starts a span per request, reported under the given service name.
+func (s *Server) WithTracing(service string) *Server {
+	s.tracing = service
+	return s
+}
+
+// WithTLS terminates TLS on the public port. HTTP/2 is negotiated via ALPN.
+func (s *Server) WithTLS(cfg *tls.Config) *Server {
+	s.tls = cfg
+	return s
+}
 
+// WithRedirect serves plain HTTP on port, redirecting every request to HTTPS.
+func (s *Server) WithRedirect(port int) *Server {
+	s.redirectPort = port
+	return s
+}
+
+// WithH2C accepts HTTP/2 without TLS on the public port.
+func (s *Server) WithH2C() *Server {
+	s.h2c = true
+	return s
+}
+
+// WithShutdown sets how long to keep serving after readiness fails and how
+// long in-flight requests may take to finish afterwards.
+func (s *Server) WithShutdown(preStopDelay, drainTimeout time.Duration) *Server {
+	s.preStopDelay = preStopDelay
+	s.drainTimeout = drainTimeout
+	return s
+}
+
+func (s *Server) WithRateLimiter(store ratelimit.Store) *Server {
+	s.limiter = store
+	return s
+}
+
+// WithTrustedProxies lists the proxies, as IPs or CIDRs, whose forwarding
+// headers name the client IP. Without them the peer address is the client IP,
+// so that IP rate limits can not be dodged with a forged X-Forwarded-For.
+func (s *Server) WithTrustedProxies(proxies []string) *Server {
+	s.trustedProxies = proxies
+	return s
+}
+
+func (s *Server) WithTranscoder(t *transcode.Transcoder) *Server {
+	s.transcoder = t
+	return s
+}
+
+func (s *Server) Run() {
+	handler := s.trackInFlight(s.router)
+	if s.h2c && s.tls == nil {
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
 	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%d", s.port),
-		Handler: s.router,
+		Addr:      fmt.Sprintf(":%d", s.port),
+		Handler:   handler,
+		TLSConfig: s.tls,
 	}
 
-	s.l.Info().Str("addr", srv.Addr).Msg("starting server")
+	s.l.Info().Str("addr", srv.Addr).Bool("tls", s.tls != nil).Msg("starting server")
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		var err error
+		if s.tls != nil {
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			s.l.Fatal().Err(err).Stack().Msg("failed to start server")
 		}
 	}()
 
+	var redirectSrv *http.Server
+	if s.tls != nil && s.redirectPort > 0 {
+		redirectSrv = &http.Server{
+			Addr:    fmt.Sprintf(":%d", s.redirectPort),
+			Handler: redirectHTTPS(s.port),
+		}
+		s.l.Info().Str("addr", redirectSrv.Addr).Msg("starting https redirect server")
+		go func() {
+			if err := redirectSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				s.l.Fatal().Err(err).Stack().Msg("failed to start redirect server")
+			}
+		}()
+	}
+
+	var adminSrv *http.Server
+	if s.adminPort > 0 {
+		adminSrv = &http.Server{
+			Addr:    fmt.Sprintf(":%d", s.adminPort),
+			Handler: s.admin,
+		}
+		s.l.Info().Str("addr", adminSrv.Addr).Msg("starting admin server")
+		go func() {
+			if err := adminSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				s.l.Fatal().Err(err).Stack().Msg("failed to start admin server")
+			}
+		}()
+	}
+
 	quit := make(chan os.Signal, 2)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
+	s.shutdown(srv, quit, adminSrv, redirectSrv)
+}
+
+func redirectHTTPS(port int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+		u := *r.URL
+		u.Scheme, u.Host = "https", host
+		http.Redirect(w, r, u.String(), http.StatusPermanentRedirect)
+	})
+}
+
+// shutdown stops the gateway in phases: readiness is failed first so load
+// balancers stop routing to us, in-flight requests are then drained until the
+// drain timeout, and upstream connections are closed last. A second signal
+// skips the pre-stop delay.
+func (s *Server) shutdown(srv *http.Server, quit <-chan os.Signal, aux ...*http.Server) {
 	s.l.Info().Msg("shutting down gracefully")
+	if s.health != nil {
+		s.health.Shutdown()
+	}
+
+	if s.preStopDelay > 0 {
+		s.l.Info().Dur("delay", s.preStopDelay).Msg("waiting for load balancers to deregister")
+		select {
+		case <-time.After(s.preStopDelay):
+		case <-quit:
+			s.l.Warn().Msg("pre-stop delay interrupted")
+		}
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	s.l.Info().Int64("inFlight", s.inFlight.Load()).Msg("draining requests")
+	ctx, cancel := context.WithTimeout(context.Background(), s.drainTimeout)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
-		s.l.Fatal().Err(err).Stack().Msg("failed to shut down gracefully")
+		cut := s.inFlight.Load()
+		s.l.Error().Err(err).Int64("cutOff", cut).Msg("drain timeout exceeded, closing remaining connections")
+		if err := srv.Close(); err != nil {
+			s.l.Error().Err(err).Msg("failed to close server")
+		}
+	}
+
+	for name, u := range s.proxs.upstreams {
+		c, ok := u.(io.Closer)
+		if !ok {
+			continue
+		}
+		if err := c.Close(); err != nil {
+			s.l.Error().Err(err).Str("upstream", name).Msg("failed to close upstream connection")
+		}
 	}
 
-	select {
-	case <-ctx.Done():
-		s.l.Info().Msg("server stopped")
+	// Admin and redirect listeners are only stopped once draining is over,
+	// so probes and metrics stay available until the end.
+	for _, a := range aux {
+		if a == nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		if err := a.Shutdown(ctx); err != nil {
+			s.l.Error().Err(err).Str("addr", a.Addr).Msg("failed to shut down server")
+		}
+		cancel()
 	}
+	s.l.Info().Msg("server stopped")
+}
+
+func (s *Server) trackInFlight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+type Upstream interface {
+	Handlers() map[string]gin.HandlerFunc
+}
+
+// GRPCUpstream is an upstream that rpc routes can be transcoded to.
+type GRPCUpstream interface {
+	Upstream
+	Conn() grpc.ClientConnInterface
 }
 
 type Proxs struct {
-	auth *auth.Proxy
+	upstreams map[string]Upstream
 }
 
-func (p *Proxs) WithAuth(auth *auth.Proxy) *Proxs {
-	p.auth = auth
+func (p *Proxs) With(name string, u Upstream) *Proxs {
+	p.upstreams[name] = u
 	return p
 }
 
 func NewProxs() *Proxs {
-	return &Proxs{}
+	return &Proxs{upstreams: make(map[string]Upstream)}
 }
 
 func NewServer(port int, l zerolog.Logger) *Server {
-	s := &Server{port: port, l: l}
+	s := &Server{
+		port:            port,
+		l:               l,
+		admin:           http.NewServeMux(),
+		requestIdHeader: middleware.RequestIdHeader,
+		accessLogSample: 1,
+		drainTimeout:    5 * time.Second,
+	}
 	return s
 }
 
-func (s *Server) SetRouter(secret string) {
-	r := gin.Default()
-	r.Use(middleware.RequestId())
-	r.POST("/api/users/register", s.proxs.auth.RegisterHandler())
-	r.POST("/api/users/login", s.proxs.auth.LoginHandler())
-	r.POST("/api/users/refresh", s.proxs.auth.RefreshHandler())
-
-	authorizedAdmin := r.Group("/")
-	authorizedAdmin.Use(middleware.Authorize(secret, true))
-	authorizedAdmin.POST("/api/users/:id/banned", s.proxs.auth.SetBannedHandler())
-	authorizedAdmin.POST("/api/users/:id/deleted", s.proxs.auth.SetDeletedHandler())
-	authorizedAdmin.POST("/api/users/:id/admin", s.proxs.auth.SetAdminHandler())
+func (s *Server) SetRouter(authn *middleware.Authenticator, table *routes.Table) error {
+	r := gin.New()
+	r.ContextWithFallback = true
+	if err := r.SetTrustedProxies(s.trustedProxies); err != nil {
+		return errors.Wrap(err, "invalid trusted proxies")
+	}
+	r.Use(gin.Recovery())
+	r.Use(middleware.RequestId(s.requestIdHeader))
+	if s.tracing != "" {
+		r.Use(tracing.Middleware(s.tracing), tracing.RequestAttributes())
+	}
+	r.Use(middleware.AccessLog(s.l, s.accessLogSample))
+	if s.metrics != nil {
+		r.Use(s.metrics.Middleware())
+	}
+	if s.health != nil {
+		for name, u := range s.proxs.upstreams {
+			if gu, ok := u.(GRPCUpstream); ok {
+				s.health.With(name, health.GRPC(gu.Conn()))
+			}
+		}
+	}
+	// Preflights are answered per path, since gin only matches the methods
+	// registered for it.
+	preflight := make(map[string]map[string]*cors.Policy)
+	for _, rt := range table.Routes {
+		h, err := s.handler(rt)
+		if err != nil {
+			return err
+		}
+		var chain []gin.HandlerFunc
+		cp := table.CORSPolicy(rt)
+		if cp != nil {
+			chain = append(chain, middleware.CORS(cp))
+		}
+		if preflight[rt.Path] == nil {
+			preflight[rt.Path] = make(map[string]*cors.Policy)
+		}
+		preflight[rt.Path][rt.Method] = cp
+		if rt.Timeout > 0 {
+			chain = append(chain, middleware.Timeout(rt.Timeout))
+		}
+		// IP limits run before authentication so that they also shield it.
+		limit := s.rateLimit(rt)
+		if limit != nil && rt.RateLimit.Key == ratelimit.KeyIP {
+			chain = append(chain, limit)
+		}
+		if rt.Auth {
+			g := table.Group(rt)
+			opts := middleware.TokenOptions{Issuers: g.Issuers, Audiences: g.Audiences, Leeway: g.Leeway, Methods: g.AuthMethods}
+			chain = append(chain, authn.Authorize(opts, table.Policy(rt)))
+			if s.limiter != nil && len(table.APIKeyTiers) > 0 && slices.Contains(g.AuthMethods, identity.MethodAPIKey) {
+				chain = append(chain, middleware.TierRateLimit(s.limiter, table.APIKeyTiers, table.DefaultAPIKeyTier, s.l))
+			}
+		}
+		if limit != nil && rt.RateLimit.Key != ratelimit.KeyIP {
+			chain = append(chain, limit)
+		}
+		chain = append(chain, h)
+		r.Handle(rt.Method, rt.Path, chain...)
+	}
+	for path, policies := range preflight {
+		if _, ok := policies[http.MethodOptions]; ok {
+			continue
+		}
+		r.OPTIONS(path, middleware.Preflight(policies))
+	}
 	s.router = r
+	return nil
+}
+
+func (s *Server) rateLimit(rt routes.Route) gin.HandlerFunc {
+	if rt.RateLimit == nil || s.limiter == nil {
+		return nil
+	}
+	return middleware.RateLimit(s.limiter, rt.Method+" "+rt.Path, *rt.RateLimit, s.l)
+}
+
+func (s *Server) handler(rt routes.Route) (gin.HandlerFunc, error) {
+	u, ok := s.proxs.upstreams[rt.Upstream]
+	if !ok {
+		return nil, fmt.Errorf("route %s %s: unknown upstream %q", rt.Method, rt.Path, rt.Upstream)
+	}
+	if rt.RPC != "" {
+		if s.transcoder == nil {
+			return nil, fmt.Errorf("route %s %s: rpc routes require a transcoder", rt.Method, rt.Path)
+		}
+		gu, ok := u.(GRPCUpstream)
+		if !ok {
+			return nil, fmt.Errorf("route %s %s: upstream %q does not serve rpc routes", rt.Method, rt.Path, rt.Upstream)
+		}
+		h, err := s.transcoder.Handler(gu.Conn(), rt.RPC, rt.Params)
+		if err != nil {
+			return nil, errors.Wrapf(err, "route %s %s", rt.Method, rt.Path)
+		}
+		return h, nil
+	}
+	h, ok := u.Handlers()[rt.Handler]
+	if !ok {
+		return nil, fmt.Errorf("route %s %s: upstream %q has no handler %q", rt.Method, rt.Path, rt.Upstream, rt.Handler)
+	}
+	return h, nil
 }
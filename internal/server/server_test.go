@@ -0,0 +1,196 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+
+	"github.com/vindosVP/snapigw/internal/health"
+	"github.com/vindosVP/snapigw/internal/middleware"
+	"github.com/vindosVP/snapigw/internal/ratelimit"
+	"github.com/vindosVP/snapigw/internal/routes"
+)
+
+type stub map[string]gin.HandlerFunc
+
+func (s stub) Handlers() map[string]gin.HandlerFunc {
+	return s
+}
+
+const limited = `
+routes:
+  - path: /login
+    method: POST
+    upstream: auth
+    handler: login
+    rateLimit:
+      algorithm: sliding_window
+      requests: 1
+      window: 1m
+      key: ip
+`
+
+func newServer(t *testing.T, table string, proxies []string) (*Server, error) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	tb, err := routes.Parse([]byte(table))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(0, zerolog.Nop()).
+		WithProxs(NewProxs().With("auth", stub{"login": func(c *gin.Context) { c.Status(http.StatusOK) }})).
+		WithRateLimiter(ratelimit.NewMemoryStore()).
+		WithTrustedProxies(proxies)
+	return s, s.SetRouter(middleware.NewAuthenticator(middleware.Keyfunc("secret", nil)), tb)
+}
+
+func TestTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		// want is the status of a second login from the same peer claiming
+		// another client address.
+		want int
+	}{
+		{name: "forwarded header ignored by default", want: http.StatusTooManyRequests},
+		{name: "forwarded header from another network ignored", proxies: []string{"192.168.0.0/16"}, want: http.StatusTooManyRequests},
+		{name: "forwarded header from a trusted proxy", proxies: []string{"10.0.0.0/8"}, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newServer(t, limited, tt.proxies)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var codes []int
+			for _, client := range []string{"203.0.113.1", "203.0.113.2"} {
+				req := httptest.NewRequest(http.MethodPost, "/login", nil)
+				req.RemoteAddr = "10.0.0.5:40000"
+				req.Header.Set("X-Forwarded-For", client)
+				w := httptest.NewRecorder()
+				s.router.ServeHTTP(w, req)
+				codes = append(codes, w.Code)
+			}
+			if codes[0] != http.StatusOK || codes[1] != tt.want {
+				t.Errorf("statuses = %v, want [200 %d]", codes, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetRouterErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		table   string
+		proxies []string
+		wantErr string
+	}{
+		{name: "invalid trusted proxy", table: limited, proxies: []string{"not-an-ip"}, wantErr: "invalid trusted proxies"},
+		{name: "unknown upstream", table: strings.Replace(limited, "upstream: auth", "upstream: billing", 1), wantErr: "unknown upstream"},
+		{name: "unknown handler", table: strings.Replace(limited, "handler: login", "handler: logout", 1), wantErr: "has no handler"},
+		{name: "rpc without a transcoder", table: strings.Replace(limited, "handler: login", "rpc: auth.Auth/Login", 1), wantErr: "require a transcoder"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newServer(t, tt.table, tt.proxies)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("SetRouter() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// syncBuffer lets the test read the log while the server writes to it.
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.String()
+}
+
+func TestShutdown(t *testing.T) {
+	const (
+		preStop = 200 * time.Millisecond
+		drain   = 200 * time.Millisecond
+	)
+	logs := &syncBuffer{}
+	h := health.New(time.Second)
+	s := NewServer(0, zerolog.New(logs)).WithProxs(NewProxs()).WithHealth(h).WithShutdown(preStop, drain)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	mux.HandleFunc("/fast", func(w http.ResponseWriter, r *http.Request) {})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: s.trackInFlight(mux)}
+	go func() { _ = srv.Serve(ln) }()
+	url := "http://" + ln.Addr().String()
+	go func() {
+		if resp, err := http.Get(url + "/slow"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		s.shutdown(srv, make(chan os.Signal))
+		close(done)
+	}()
+
+	// Readiness fails right away, while the pre-stop delay keeps serving.
+	for {
+		if _, ok := h.Ready(context.Background()); !ok {
+			break
+		}
+		if time.Since(start) > preStop/2 {
+			t.Fatal("readiness did not fail before the pre-stop delay ended")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	resp, err := http.Get(url + "/fast")
+	if err != nil {
+		t.Fatalf("request during the pre-stop delay: %v", err)
+	}
+	resp.Body.Close()
+	if time.Since(start) >= preStop {
+		t.Fatal("pre-stop delay ended before the request was served")
+	}
+
+	<-done
+	if elapsed := time.Since(start); elapsed < preStop+drain || elapsed > preStop+drain+time.Second {
+		t.Errorf("shutdown took %v, want about %v", elapsed, preStop+drain)
+	}
+	if !strings.Contains(logs.String(), `"cutOff":1`) {
+		t.Errorf("log does not count one cut off request:\n%s", logs)
+	}
+}
@@ -11,6 +11,7 @@ import (
 )
 
 type Client struct {
+	conn *grpc.ClientConn
 	grpc authv1.AuthClient
 }
 
@@ -93,11 +94,17 @@ func (c Client) RefreshToken(ctx context.Context, token string) (*TokenPair, err
 	return tp, nil
 }
 
-func NewClient(addr string) (*Client, error) {
-	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+func (c Client) Close() error {
+	return c.conn.Close()
+}
+
+// NewClient dials addr in plaintext unless opts carry transport credentials.
+func NewClient(addr string, opts ...grpc.DialOption) (*Client, error) {
+	opts = append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...)
+	conn, err := grpc.NewClient(addr, opts...)
 	if err != nil {
 		return nil, errors.Wrap(err, "could not connect to auth service")
 	}
 	client := authv1.NewAuthClient(conn)
-	return &Client{client}, nil
+	return &Client{conn: conn, grpc: client}, nil
 }
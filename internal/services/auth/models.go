@@ -1,18 +1,20 @@
 package auth
 
+import "time"
+
 type TokenPair struct {
-	AccessToken  string `json:"accessToken"`
-	RefreshToken string `json:"refreshToken"`
+	AccessToken  string `json:"accessToken" log:"redact"`
+	RefreshToken string `json:"refreshToken" log:"redact"`
 }
 
 type RegisterRequest struct {
-	Email    string `json:"email" validate:"email,required"`
-	Password string `json:"password" validate:"required,min=8"`
+	Email    string `json:"email" validate:"email,required" log:"redact"`
+	Password string `json:"password" validate:"required,min=8" log:"redact"`
 }
 
 type LoginRequest struct {
-	Email    string `json:"email" validate:"email,required"`
-	Password string `json:"password" validate:"required"`
+	Email    string `json:"email" validate:"email,required" log:"redact"`
+	Password string `json:"password" validate:"required" log:"redact"`
 }
 
 type SetBannedRequest struct {
@@ -28,12 +30,21 @@ type SetAdminRequest struct {
 }
 
 type RefreshRequest struct {
-	RefreshToken string `json:"refreshToken"`
+	RefreshToken string `json:"refreshToken" log:"redact"`
+}
+
+// LogoutRequest optionally names the refresh token to revoke with the access token.
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken" log:"redact"`
 }
 
 type LoginResponse struct {
-	AccessToken  string `json:"accessToken"`
-	RefreshToken string `json:"refreshToken"`
+	AccessToken  string `json:"accessToken" log:"redact"`
+	RefreshToken string `json:"refreshToken" log:"redact"`
+}
+
+type LockedResponse struct {
+	LockedUntil time.Time `json:"lockedUntil"`
 }
 
 type RegisterResponse struct {
@@ -41,8 +52,8 @@ type RegisterResponse struct {
 }
 
 type RefreshResponse struct {
-	AccessToken  string `json:"accessToken"`
-	RefreshToken string `json:"refreshToken"`
+	AccessToken  string `json:"accessToken" log:"redact"`
+	RefreshToken string `json:"refreshToken" log:"redact"`
 }
 
 type SetBannedResponse struct {
@@ -1,30 +1,140 @@
 package auth
 
 import (
+	"io"
+	"math"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
+	"github.com/vindosVP/snapigw/internal/audit"
+	"github.com/vindosVP/snapigw/internal/identity"
+	"github.com/vindosVP/snapigw/internal/lockout"
+	"github.com/vindosVP/snapigw/internal/revocation"
+	"github.com/vindosVP/snapigw/internal/upstream"
 	"github.com/vindosVP/snapigw/internal/utils/response"
 )
 
 type Proxy struct {
-	client *Client
-	l      zerolog.Logger
+	client     *Client
+	l          zerolog.Logger
+	revoked    revocation.Store
+	propagator *identity.Propagator
+	lockout    *lockout.Guard
+	auditor    *audit.Auditor
+}
+
+func (p *Proxy) WithAuditor(a *audit.Auditor) *Proxy {
+	p.auditor = a
+	return p
+}
+
+// record writes the outcome of an administrative change to the audit log.
+func (p *Proxy) record(c *gin.Context, action string, userId int, requested, result bool, err error) {
+	if p.auditor == nil {
+		return
+	}
+	e := audit.Entry{
+		TargetId:  strconv.Itoa(userId),
+		Action:    action,
+		NewValue:  result,
+		RequestId: c.GetString("requestId"),
+		ClientIP:  c.ClientIP(),
+		Outcome:   audit.OutcomeSuccess,
+	}
+	if id, ok := identity.From(c); ok {
+		e.ActorId = id.Id
+	}
+	if err != nil {
+		e.NewValue = requested
+		e.Outcome = audit.OutcomeFailure
+		e.Error = status.Code(err).String()
+	}
+	p.auditor.Record(c, e)
+}
+
+func (p *Proxy) WithLockout(g *lockout.Guard) *Proxy {
+	p.lockout = g
+	return p
+}
+
+func (p *Proxy) respondLocked(c *gin.Context, until time.Time) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(until).Seconds()))))
+	response.ErrCodeData(c, http.StatusTooManyRequests, "login_locked", "too many failed login attempts", &LockedResponse{LockedUntil: until})
+}
+
+// respondUnavailable answers failures of the auth service itself: 503
+// without waiting on it while its circuit breaker is open and 504 when the
+// call ran out of time. It reports whether it responded.
+func (p *Proxy) respondUnavailable(c *gin.Context, lg zerolog.Logger, err error) bool {
+	var open *upstream.OpenError
+	switch {
+	case errors.As(err, &open):
+		open.SetRetryAfter(c)
+		response.Err(c, http.StatusServiceUnavailable, "auth service is unavailable")
+	case status.Code(err) == codes.DeadlineExceeded:
+		lg.Warn().Msg("auth service timed out")
+		response.Err(c, http.StatusGatewayTimeout, "auth service timed out")
+	default:
+		return false
+	}
+	return true
+}
+
+func (p *Proxy) WithPropagator(pr *identity.Propagator) *Proxy {
+	p.propagator = pr
+	return p
+}
+
+func (p *Proxy) WithRevocation(s revocation.Store) *Proxy {
+	p.revoked = s
+	return p
+}
+
+// revokeUser makes tokens issued to a banned or deleted user stop working
+// before they expire.
+func (p *Proxy) revokeUser(c *gin.Context, lg zerolog.Logger, userId int) {
+	if p.revoked == nil {
+		return
+	}
+	if err := p.revoked.RevokeUser(c, userId, time.Now()); err != nil {
+		lg.Error().Err(err).Int("userId", userId).Msg("failed to revoke user tokens")
+	}
+}
+
+type refreshClaims struct {
+	jwt.RegisteredClaims
+	Id int `json:"id"`
+}
+
+// parseRefreshToken reads the claims of a JWT refresh token without
+// verifying it. The auth service verifies refresh tokens; the gateway only
+// needs their id to keep used and logged out tokens on the deny-list.
+// Opaque tokens and tokens without an id or expiry are reported as not ok.
+func parseRefreshToken(token string) (*refreshClaims, bool) {
+	claims := &refreshClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		return nil, false
+	}
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil, false
+	}
+	return claims, true
 }
 
 func (p *Proxy) SetAdminHandler() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		reqId := c.GetString("requestId")
-		lg := p.l.With().Str("requestId", reqId).Logger()
+		lg := p.l.With().Ctx(c).Str("requestId", reqId).Logger()
 		req := &SetAdminRequest{}
 		err := c.BindJSON(req)
 		if err != nil {
@@ -56,10 +166,18 @@ func (p *Proxy) SetAdminHandler() func(c *gin.Context) {
 			return
 		}
 
-		meta := map[string]string{"requestId": reqId}
-		ctx := metadata.NewOutgoingContext(c, metadata.New(meta))
+		ctx, err := p.propagator.OutgoingContext(c)
+		if err != nil {
+			lg.Error().Err(err).Stack().Msg("failed to build upstream context")
+			response.Err(c, http.StatusInternalServerError, "failed to set admin flag")
+			return
+		}
 		admin, err := p.client.SetAdmin(ctx, int64(userId), *req.IsAdmin)
+		p.record(c, "user.setAdmin", userId, *req.IsAdmin, admin, err)
 		if err != nil {
+			if p.respondUnavailable(c, lg, err) {
+				return
+			}
 			s, ok := status.FromError(err)
 			if !ok {
 				lg.Error().Stack().Msg("failed to create error from code")
@@ -84,7 +202,7 @@ func (p *Proxy) SetAdminHandler() func(c *gin.Context) {
 func (p *Proxy) SetDeletedHandler() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		reqId := c.GetString("requestId")
-		lg := p.l.With().Str("requestId", reqId).Logger()
+		lg := p.l.With().Ctx(c).Str("requestId", reqId).Logger()
 		req := &SetDeletedRequest{}
 		err := c.BindJSON(req)
 		if err != nil {
@@ -116,10 +234,18 @@ func (p *Proxy) SetDeletedHandler() func(c *gin.Context) {
 			return
 		}
 
-		meta := map[string]string{"requestId": reqId}
-		ctx := metadata.NewOutgoingContext(c, metadata.New(meta))
+		ctx, err := p.propagator.OutgoingContext(c)
+		if err != nil {
+			lg.Error().Err(err).Stack().Msg("failed to build upstream context")
+			response.Err(c, http.StatusInternalServerError, "failed to set deleted flag")
+			return
+		}
 		deleted, err := p.client.SetDeleted(ctx, int64(userId), *req.IsDeleted)
+		p.record(c, "user.setDeleted", userId, *req.IsDeleted, deleted, err)
 		if err != nil {
+			if p.respondUnavailable(c, lg, err) {
+				return
+			}
 			s, ok := status.FromError(err)
 			if !ok {
 				lg.Error().Stack().Msg("failed to create error from code")
@@ -137,6 +263,9 @@ func (p *Proxy) SetDeletedHandler() func(c *gin.Context) {
 			}
 			return
 		}
+		if deleted {
+			p.revokeUser(c, lg, userId)
+		}
 		response.OkMsg(c, http.StatusOK, &SetDeletedResponse{IsDeleted: deleted}, "set deleted flag successfully")
 	}
 }
@@ -144,7 +273,7 @@ func (p *Proxy) SetDeletedHandler() func(c *gin.Context) {
 func (p *Proxy) SetBannedHandler() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		reqId := c.GetString("requestId")
-		lg := p.l.With().Str("requestId", reqId).Logger()
+		lg := p.l.With().Ctx(c).Str("requestId", reqId).Logger()
 		req := &SetBannedRequest{}
 		err := c.BindJSON(req)
 		if err != nil {
@@ -176,10 +305,18 @@ func (p *Proxy) SetBannedHandler() func(c *gin.Context) {
 			return
 		}
 
-		meta := map[string]string{"requestId": reqId}
-		ctx := metadata.NewOutgoingContext(c, metadata.New(meta))
+		ctx, err := p.propagator.OutgoingContext(c)
+		if err != nil {
+			lg.Error().Err(err).Stack().Msg("failed to build upstream context")
+			response.Err(c, http.StatusInternalServerError, "failed to set banned flag")
+			return
+		}
 		banned, err := p.client.SetBanned(ctx, int64(userId), *req.IsBanned)
+		p.record(c, "user.setBanned", userId, *req.IsBanned, banned, err)
 		if err != nil {
+			if p.respondUnavailable(c, lg, err) {
+				return
+			}
 			s, ok := status.FromError(err)
 			if !ok {
 				lg.Error().Stack().Msg("failed to create error from code")
@@ -197,6 +334,9 @@ func (p *Proxy) SetBannedHandler() func(c *gin.Context) {
 			}
 			return
 		}
+		if banned {
+			p.revokeUser(c, lg, userId)
+		}
 		response.OkMsg(c, http.StatusOK, &SetBannedResponse{IsBanned: banned}, "set banned flag successfully")
 	}
 }
@@ -204,33 +344,71 @@ func (p *Proxy) SetBannedHandler() func(c *gin.Context) {
 func (p *Proxy) RefreshHandler() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		reqId := c.GetString("requestId")
+		lg := p.l.With().Ctx(c).Str("requestId", reqId).Logger()
 		req := &RefreshRequest{}
 		err := c.BindJSON(req)
 		if err != nil {
-			log.Info().Str("requestId", reqId).Msg("invalid request structure")
+			lg.Info().Msg("invalid request structure")
 			response.Err(c, http.StatusBadRequest, "invalid request structure")
 			return
 		}
 		err = validator.New().Struct(req)
 		if err != nil {
-			log.Info().Str("requestId", reqId).Msg("invalid request")
+			lg.Info().Msg("invalid request")
 			response.Err(c, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		meta := map[string]string{"requestId": reqId}
-		ctx := metadata.NewOutgoingContext(c, metadata.New(meta))
+		rc, single := parseRefreshToken(req.RefreshToken)
+		if single && p.revoked != nil {
+			var issuedAt time.Time
+			if rc.IssuedAt != nil {
+				issuedAt = rc.IssuedAt.Time
+			}
+			revoked, err := p.revoked.IsRevoked(c, "", rc.Id, issuedAt)
+			if err != nil {
+				lg.Error().Err(err).Msg("failed to check refresh token revocation")
+				response.Err(c, http.StatusServiceUnavailable, "failed to check token revocation")
+				return
+			}
+			// Each refresh token is exchanged once. It is claimed before the
+			// upstream call so that concurrent replays can not both get through.
+			if !revoked {
+				claimed, err := p.revoked.ClaimToken(c, rc.ID, rc.ExpiresAt.Time)
+				if err != nil {
+					lg.Error().Err(err).Msg("failed to claim refresh token")
+					response.Err(c, http.StatusServiceUnavailable, "failed to check token revocation")
+					return
+				}
+				revoked = !claimed
+			}
+			if revoked {
+				lg.Info().Msg("revoked refresh token used")
+				response.Err(c, http.StatusUnauthorized, "refresh token is revoked")
+				return
+			}
+		}
+
+		ctx, err := p.propagator.OutgoingContext(c)
+		if err != nil {
+			lg.Error().Err(err).Stack().Msg("failed to build upstream context")
+			response.Err(c, http.StatusInternalServerError, "refresh failed")
+			return
+		}
 		tp, err := p.client.RefreshToken(ctx, req.RefreshToken)
 		if err != nil {
+			if p.respondUnavailable(c, lg, err) {
+				return
+			}
 			s, ok := status.FromError(err)
 			if !ok {
-				log.Error().Stack().Msg("failed to create error from code")
+				lg.Error().Stack().Msg("failed to create error from code")
 				response.Err(c, http.StatusInternalServerError, "refresh failed")
 				return
 			}
 			switch s.Code() {
 			case codes.InvalidArgument:
-				log.Error().Msg("no requestId specified")
+				lg.Error().Msg("no requestId specified")
 				response.Err(c, http.StatusInternalServerError, "refresh failed")
 			case codes.FailedPrecondition:
 				response.Err(c, http.StatusBadRequest, "user is unable to log in")
@@ -243,35 +421,92 @@ func (p *Proxy) RefreshHandler() func(c *gin.Context) {
 	}
 }
 
+// LogoutHandler revokes the caller's access token by its id and, when the
+// body names one, the caller's refresh token. Access tokens without an id or
+// expiry can not be revoked one by one, so every token issued to the user so
+// far is revoked instead.
+func (p *Proxy) LogoutHandler() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		reqId := c.GetString("requestId")
+		lg := p.l.With().Ctx(c).Str("requestId", reqId).Logger()
+		req := &LogoutRequest{}
+		if err := c.ShouldBindJSON(req); err != nil && !errors.Is(err, io.EOF) {
+			lg.Info().Msg("invalid request structure")
+			response.Err(c, http.StatusBadRequest, "invalid request structure")
+			return
+		}
+		if p.revoked == nil {
+			lg.Error().Msg("token revocation is not configured")
+			response.Err(c, http.StatusInternalServerError, "logout failed")
+			return
+		}
+
+		userId := c.GetInt("userId")
+		var err error
+		if jti, exp := c.GetString("tokenId"), c.GetTime("tokenExpiresAt"); jti != "" && !exp.IsZero() {
+			err = p.revoked.RevokeToken(c, jti, exp)
+		} else {
+			err = p.revoked.RevokeUser(c, userId, time.Now())
+		}
+		if rc, ok := parseRefreshToken(req.RefreshToken); err == nil && ok && rc.Id == userId {
+			err = p.revoked.RevokeToken(c, rc.ID, rc.ExpiresAt.Time)
+		}
+		if err != nil {
+			lg.Error().Err(err).Int("userId", userId).Msg("failed to revoke tokens")
+			response.Err(c, http.StatusServiceUnavailable, "logout failed")
+			return
+		}
+		response.OkMsg(c, http.StatusOK, nil, "logout success")
+	}
+}
+
 func (p *Proxy) LoginHandler() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		reqId := c.GetString("requestId")
+		lg := p.l.With().Ctx(c).Str("requestId", reqId).Logger()
 		req := &LoginRequest{}
 		err := c.BindJSON(req)
 		if err != nil {
-			log.Info().Str("requestId", reqId).Msg("invalid request structure")
+			lg.Info().Msg("invalid request structure")
 			response.Err(c, http.StatusBadRequest, "invalid request structure")
 			return
 		}
 		err = validator.New().Struct(req)
 		if err != nil {
-			log.Info().Str("requestId", reqId).Msg("invalid request")
+			lg.Info().Msg("invalid request")
 			response.Err(c, http.StatusBadRequest, err.Error())
 			return
 		}
+		if p.lockout != nil {
+			if until, locked := p.lockout.Locked(req.Email, c.ClientIP()); locked {
+				lg.Info().Time("lockedUntil", until).Msg("login locked out")
+				p.respondLocked(c, until)
+				return
+			}
+		}
 
-		meta := map[string]string{"requestId": reqId}
-		ctx := metadata.NewOutgoingContext(c, metadata.New(meta))
+		ctx, err := p.propagator.OutgoingContext(c)
+		if err != nil {
+			lg.Error().Err(err).Stack().Msg("failed to build upstream context")
+			response.Err(c, http.StatusInternalServerError, "login failed")
+			return
+		}
 		tp, err := p.client.Login(ctx, req.Email, req.Password)
 		if err != nil {
+			if p.respondUnavailable(c, lg, err) {
+				return
+			}
 			s, ok := status.FromError(err)
 			if !ok {
-				log.Error().Stack().Msg("failed to create error from code")
+				lg.Error().Stack().Msg("failed to create error from code")
 				response.Err(c, http.StatusInternalServerError, "login failed")
 				return
 			}
 			switch s.Code() {
 			case codes.InvalidArgument:
+				if p.lockout != nil {
+					p.lockout.Fail(req.Email, c.ClientIP())
+				}
 				response.Err(c, http.StatusBadRequest, "invalid login or password")
 			case codes.FailedPrecondition:
 				response.Err(c, http.StatusBadRequest, "user is unable to log in")
@@ -280,6 +515,9 @@ func (p *Proxy) LoginHandler() func(c *gin.Context) {
 			}
 			return
 		}
+		if p.lockout != nil {
+			p.lockout.Reset(req.Email)
+		}
 		response.OkMsg(c, http.StatusOK, &LoginResponse{AccessToken: tp.AccessToken, RefreshToken: tp.RefreshToken}, "login success")
 	}
 }
@@ -287,33 +525,41 @@ func (p *Proxy) LoginHandler() func(c *gin.Context) {
 func (p *Proxy) RegisterHandler() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		reqId := c.GetString("requestId")
+		lg := p.l.With().Ctx(c).Str("requestId", reqId).Logger()
 		req := &RegisterRequest{}
 		err := c.BindJSON(req)
 		if err != nil {
-			log.Info().Str("requestId", reqId).Msg("invalid request structure")
+			lg.Info().Msg("invalid request structure")
 			response.Err(c, http.StatusBadRequest, "invalid request structure")
 			return
 		}
 		err = validator.New().Struct(req)
 		if err != nil {
-			log.Info().Str("requestId", reqId).Msg("invalid request")
+			lg.Info().Msg("invalid request")
 			response.Err(c, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		meta := map[string]string{"requestId": reqId}
-		ctx := metadata.NewOutgoingContext(c, metadata.New(meta))
+		ctx, err := p.propagator.OutgoingContext(c)
+		if err != nil {
+			lg.Error().Err(err).Stack().Msg("failed to build upstream context")
+			response.Err(c, http.StatusInternalServerError, "register failed")
+			return
+		}
 		id, err := p.client.Register(ctx, req.Email, req.Password)
 		if err != nil {
+			if p.respondUnavailable(c, lg, err) {
+				return
+			}
 			s, ok := status.FromError(err)
 			if !ok {
-				log.Error().Stack().Msg("failed to create error from code")
+				lg.Error().Stack().Msg("failed to create error from code")
 				response.Err(c, http.StatusInternalServerError, "register failed")
 				return
 			}
 			switch s.Code() {
 			case codes.InvalidArgument:
-				log.Error().Msg("no requestId specified")
+				lg.Error().Msg("no requestId specified")
 				response.Err(c, http.StatusInternalServerError, "register failed")
 			case codes.FailedPrecondition:
 				response.Err(c, http.StatusBadRequest, "user already exists")
@@ -326,8 +572,28 @@ func (p *Proxy) RegisterHandler() func(c *gin.Context) {
 	}
 }
 
-func NewProxy(serviceAddr string, l zerolog.Logger) (*Proxy, error) {
-	c, err := NewClient(serviceAddr)
+func (p *Proxy) Handlers() map[string]gin.HandlerFunc {
+	return map[string]gin.HandlerFunc{
+		"register":   p.RegisterHandler(),
+		"login":      p.LoginHandler(),
+		"refresh":    p.RefreshHandler(),
+		"logout":     p.LogoutHandler(),
+		"setBanned":  p.SetBannedHandler(),
+		"setDeleted": p.SetDeletedHandler(),
+		"setAdmin":   p.SetAdminHandler(),
+	}
+}
+
+func (p *Proxy) Conn() grpc.ClientConnInterface {
+	return p.client.conn
+}
+
+func (p *Proxy) Close() error {
+	return p.client.Close()
+}
+
+func NewProxy(serviceAddr string, l zerolog.Logger, opts ...grpc.DialOption) (*Proxy, error) {
+	c, err := NewClient(serviceAddr, opts...)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to initialize auth client")
 	}
@@ -0,0 +1,262 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	authv1 "github.com/vindosVP/snapigw/gen/go"
+	"github.com/vindosVP/snapigw/internal/revocation"
+	"github.com/vindosVP/snapigw/internal/upstream"
+)
+
+type fakeAuth struct {
+	authv1.AuthClient
+	refreshes atomic.Int32
+	err       error
+}
+
+func (f *fakeAuth) Register(context.Context, *authv1.RegisterRequest, ...grpc.CallOption) (*authv1.RegisterResponse, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &authv1.RegisterResponse{UserId: 1}, nil
+}
+
+func (f *fakeAuth) Refresh(context.Context, *authv1.RefreshRequest, ...grpc.CallOption) (*authv1.RefreshResponse, error) {
+	f.refreshes.Add(1)
+	return &authv1.RefreshResponse{AccessToken: "access", RefreshToken: "refresh"}, nil
+}
+
+func refreshToken(t *testing.T, jti string, userId int) string {
+	t.Helper()
+	claims := &refreshClaims{Id: userId, RegisteredClaims: jwt.RegisteredClaims{
+		ID:        jti,
+		IssuedAt:  jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}}
+	s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("auth service secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func serve(h gin.HandlerFunc, set func(c *gin.Context), body string) int {
+	r := gin.New()
+	r.POST("/", func(c *gin.Context) {
+		set(c)
+		c.Next()
+	}, h)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	return w.Code
+}
+
+func TestRefreshTokensAreSingleUse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	fake := &fakeAuth{}
+	p := &Proxy{client: &Client{grpc: fake}, l: zerolog.Nop()}
+	p.WithRevocation(revocation.NewMemoryStore(time.Hour))
+	h := p.RefreshHandler()
+	noop := func(*gin.Context) {}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "first use", body: `{"refreshToken":"` + refreshToken(t, "r1", 1) + `"}`, want: http.StatusOK},
+		{name: "replay", body: `{"refreshToken":"` + refreshToken(t, "r1", 1) + `"}`, want: http.StatusUnauthorized},
+		{name: "other token", body: `{"refreshToken":"` + refreshToken(t, "r2", 1) + `"}`, want: http.StatusOK},
+		{name: "opaque token", body: `{"refreshToken":"opaque"}`, want: http.StatusOK},
+		{name: "opaque token again", body: `{"refreshToken":"opaque"}`, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		if got := serve(h, noop, tt.body); got != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+	if got := fake.refreshes.Load(); got != 4 {
+		t.Errorf("refreshes = %d, want 4", got)
+	}
+}
+
+func TestConcurrentRefreshReplay(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	fake := &fakeAuth{}
+	p := &Proxy{client: &Client{grpc: fake}, l: zerolog.Nop()}
+	p.WithRevocation(revocation.NewMemoryStore(time.Hour))
+	h := p.RefreshHandler()
+	body := `{"refreshToken":"` + refreshToken(t, "r1", 1) + `"}`
+
+	const n = 20
+	var ok atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if serve(h, func(*gin.Context) {}, body) == http.StatusOK {
+				ok.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := ok.Load(); got != 1 {
+		t.Errorf("%d of %d concurrent refreshes succeeded, want 1", got, n)
+	}
+	if got := fake.refreshes.Load(); got != 1 {
+		t.Errorf("refreshes = %d, want 1", got)
+	}
+}
+
+type failingStore struct {
+	revocation.Store
+}
+
+func (failingStore) IsRevoked(context.Context, string, int, time.Time) (bool, error) {
+	return false, nil
+}
+
+func (failingStore) ClaimToken(context.Context, string, time.Time) (bool, error) {
+	return false, errors.New("store is down")
+}
+
+func TestRefreshFailsClosed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	fake := &fakeAuth{}
+	p := &Proxy{client: &Client{grpc: fake}, l: zerolog.Nop()}
+	p.WithRevocation(failingStore{})
+	body := `{"refreshToken":"` + refreshToken(t, "r1", 1) + `"}`
+	if got := serve(p.RefreshHandler(), func(*gin.Context) {}, body); got != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", got, http.StatusServiceUnavailable)
+	}
+	if got := fake.refreshes.Load(); got != 0 {
+		t.Errorf("refreshes = %d, want 0", got)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	exp := time.Now().Add(time.Hour)
+	tests := []struct {
+		name        string
+		tokenId     string
+		body        string
+		wantStatus  int
+		wantJti     []string
+		wantNotJti  []string
+		wantUserOut bool
+	}{
+		{
+			name:       "access token",
+			tokenId:    "a1",
+			wantStatus: http.StatusOK,
+			wantJti:    []string{"a1"},
+		},
+		{
+			name:       "access and refresh token",
+			tokenId:    "a1",
+			body:       `{"refreshToken":"` + refreshToken(t, "r1", 7) + `"}`,
+			wantStatus: http.StatusOK,
+			wantJti:    []string{"a1", "r1"},
+		},
+		{
+			name:       "refresh token of another user",
+			tokenId:    "a1",
+			body:       `{"refreshToken":"` + refreshToken(t, "r1", 8) + `"}`,
+			wantStatus: http.StatusOK,
+			wantJti:    []string{"a1"},
+			wantNotJti: []string{"r1"},
+		},
+		{
+			name:        "access token without id",
+			wantStatus:  http.StatusOK,
+			wantUserOut: true,
+		},
+		{
+			name:       "invalid body",
+			tokenId:    "a1",
+			body:       `{`,
+			wantStatus: http.StatusBadRequest,
+			wantNotJti: []string{"a1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := revocation.NewMemoryStore(time.Hour)
+			p := &Proxy{l: zerolog.Nop()}
+			p.WithRevocation(store)
+			got := serve(p.LogoutHandler(), func(c *gin.Context) {
+				c.Set("userId", 7)
+				if tt.tokenId != "" {
+					c.Set("tokenId", tt.tokenId)
+					c.Set("tokenExpiresAt", exp)
+				}
+			}, tt.body)
+			if got != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", got, tt.wantStatus)
+			}
+			ctx := context.Background()
+			for _, jti := range tt.wantJti {
+				if ok, _ := store.IsRevoked(ctx, jti, 0, time.Now()); !ok {
+					t.Errorf("token %s is not revoked", jti)
+				}
+			}
+			for _, jti := range tt.wantNotJti {
+				if ok, _ := store.IsRevoked(ctx, jti, 0, time.Now()); ok {
+					t.Errorf("token %s is revoked", jti)
+				}
+			}
+			userOut, _ := store.IsRevoked(ctx, "", 7, time.Now().Add(-time.Minute))
+			if userOut != tt.wantUserOut {
+				t.Errorf("user revoked = %v, want %v", userOut, tt.wantUserOut)
+			}
+		})
+	}
+}
+
+func TestUpstreamErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name           string
+		err            error
+		wantStatus     int
+		wantRetryAfter string
+	}{
+		{name: "success", wantStatus: http.StatusOK},
+		{name: "circuit open", err: &upstream.OpenError{Upstream: "auth", RetryAfter: 1500 * time.Millisecond}, wantStatus: http.StatusServiceUnavailable, wantRetryAfter: "2"},
+		{name: "deadline", err: status.Error(codes.DeadlineExceeded, "deadline"), wantStatus: http.StatusGatewayTimeout},
+		{name: "handler specific code", err: status.Error(codes.FailedPrecondition, "exists"), wantStatus: http.StatusBadRequest},
+		{name: "other code", err: status.Error(codes.Internal, "boom"), wantStatus: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Proxy{client: &Client{grpc: &fakeAuth{err: tt.err}}, l: zerolog.Nop()}
+			r := gin.New()
+			r.POST("/", p.RegisterHandler())
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"email":"a@b.c","password":"password"}`)))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+		})
+	}
+}
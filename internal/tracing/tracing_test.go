@@ -0,0 +1,79 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestLogHook(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	ctx, span := tp.Tracer("test").Start(context.Background(), "request")
+	span.End()
+	sc := span.SpanContext()
+
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		wantTraceId string
+		wantSpanId  string
+	}{
+		{name: "active span", ctx: ctx, wantTraceId: sc.TraceID().String(), wantSpanId: sc.SpanID().String()},
+		{name: "no span", ctx: context.Background()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			l := zerolog.New(buf).Hook(LogHook{})
+			l.Info().Ctx(tt.ctx).Msg("hello")
+			var entry map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := entry["traceId"].(string); got != tt.wantTraceId {
+				t.Errorf("traceId = %q, want %q", got, tt.wantTraceId)
+			}
+			if got, _ := entry["spanId"].(string); got != tt.wantSpanId {
+				t.Errorf("spanId = %q, want %q", got, tt.wantSpanId)
+			}
+		})
+	}
+}
+
+func TestRequestAttributes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("requestId", "req-1")
+		ctx, span := tp.Tracer("test").Start(c.Request.Context(), c.FullPath())
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}, RequestAttributes())
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	spans := rec.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("ended spans = %d, want 1", len(spans))
+	}
+	want := attribute.String("request.id", "req-1")
+	for _, a := range spans[0].Attributes() {
+		if a == want {
+			return
+		}
+	}
+	t.Errorf("span attributes = %v, want %v", spans[0].Attributes(), want)
+}
@@ -0,0 +1,301 @@
+package transcode
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/vindosVP/snapigw/internal/identity"
+	"github.com/vindosVP/snapigw/internal/upstream"
+	"github.com/vindosVP/snapigw/internal/utils/response"
+)
+
+// defaultMaxBodyBytes bounds request bodies unless WithMaxBodyBytes says otherwise.
+const defaultMaxBodyBytes = 1 << 20
+
+var (
+	unmarshalOpts = protojson.UnmarshalOptions{DiscardUnknown: true}
+	marshalOpts   = protojson.MarshalOptions{EmitUnpopulated: true}
+)
+
+type Transcoder struct {
+	files      *protoregistry.Files
+	l          zerolog.Logger
+	propagator *identity.Propagator
+	maxBody    int64
+}
+
+func (t *Transcoder) WithPropagator(p *identity.Propagator) *Transcoder {
+	t.propagator = p
+	return t
+}
+
+// WithMaxBodyBytes limits the size of request bodies; larger ones get 413.
+func (t *Transcoder) WithMaxBodyBytes(n int64) *Transcoder {
+	t.maxBody = n
+	return t
+}
+
+// New builds a transcoder from a compiled FileDescriptorSet
+// (protoc --include_imports --descriptor_set_out). When path is empty the
+// descriptors linked into the binary are used instead.
+func New(path string, l zerolog.Logger) (*Transcoder, error) {
+	if path == "" {
+		return &Transcoder{files: protoregistry.GlobalFiles, l: l, maxBody: defaultMaxBodyBytes}, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read descriptor set")
+	}
+	fds := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(b, fds); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal descriptor set")
+	}
+	files, err := protodesc.NewFiles(fds)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build descriptor registry")
+	}
+	return &Transcoder{files: files, l: l, maxBody: defaultMaxBodyBytes}, nil
+}
+
+// Handler returns a gin handler invoking rpc ("package.Service/Method") on conn.
+// params maps gin path parameter names to request field names; unmapped
+// parameters are matched against fields of the same name and ignored otherwise.
+func (t *Transcoder) Handler(conn grpc.ClientConnInterface, rpc string, params map[string]string) (gin.HandlerFunc, error) {
+	md, err := t.method(rpc)
+	if err != nil {
+		return nil, err
+	}
+	for p, name := range params {
+		if field(md.Input(), name) == nil {
+			return nil, fmt.Errorf("param %s: %s has no field %q", p, md.Input().FullName(), name)
+		}
+	}
+	fullMethod := fmt.Sprintf("/%s/%s", md.Parent().FullName(), md.Name())
+	return func(c *gin.Context) {
+		reqId := c.GetString("requestId")
+		lg := t.l.With().Ctx(c).Str("requestId", reqId).Str("rpc", fullMethod).Logger()
+
+		in := dynamicpb.NewMessage(md.Input())
+		if err := readBody(c, in, t.maxBody); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				lg.Info().Int64("limit", tooLarge.Limit).Msg("request body too large")
+				response.Err(c, http.StatusRequestEntityTooLarge, "request body too large")
+				return
+			}
+			lg.Info().Err(err).Msg("invalid request structure")
+			response.Err(c, http.StatusBadRequest, "invalid request structure")
+			return
+		}
+		for _, p := range c.Params {
+			name, ok := params[p.Key]
+			if !ok {
+				if field(md.Input(), p.Key) == nil {
+					continue
+				}
+				name = p.Key
+			}
+			if err := setField(in, name, p.Value); err != nil {
+				lg.Info().Err(err).Str("param", p.Key).Msg("invalid path parameter")
+				response.Err(c, http.StatusBadRequest, fmt.Sprintf("invalid %s", p.Key))
+				return
+			}
+		}
+		if c.Request.Method == http.MethodGet {
+			for k, v := range c.Request.URL.Query() {
+				if field(md.Input(), k) == nil {
+					continue
+				}
+				if err := setField(in, k, v[len(v)-1]); err != nil {
+					lg.Info().Err(err).Str("param", k).Msg("invalid query parameter")
+					response.Err(c, http.StatusBadRequest, fmt.Sprintf("invalid %s", k))
+					return
+				}
+			}
+		}
+
+		ctx, err := t.propagator.OutgoingContext(c)
+		if err != nil {
+			lg.Error().Err(err).Stack().Msg("failed to build upstream context")
+			response.Err(c, http.StatusInternalServerError, "request failed")
+			return
+		}
+		out := dynamicpb.NewMessage(md.Output())
+		if err := conn.Invoke(ctx, fullMethod, in, out); err != nil {
+			var open *upstream.OpenError
+			if errors.As(err, &open) {
+				open.SetRetryAfter(c)
+				response.Err(c, http.StatusServiceUnavailable, "upstream is unavailable")
+				return
+			}
+			s, ok := status.FromError(err)
+			if !ok {
+				lg.Error().Err(err).Stack().Msg("failed to create error from code")
+				response.Err(c, http.StatusInternalServerError, "request failed")
+				return
+			}
+			code := httpStatus(s.Code())
+			if code >= http.StatusInternalServerError {
+				lg.Error().Str("code", s.Code().String()).Msg(s.Message())
+				response.Err(c, code, "request failed")
+				return
+			}
+			response.Err(c, code, s.Message())
+			return
+		}
+		b, err := marshalOpts.Marshal(out)
+		if err != nil {
+			lg.Error().Err(err).Stack().Msg("failed to marshal response")
+			response.Err(c, http.StatusInternalServerError, "request failed")
+			return
+		}
+		response.Ok(c, http.StatusOK, json.RawMessage(b))
+	}, nil
+}
+
+func (t *Transcoder) method(rpc string) (protoreflect.MethodDescriptor, error) {
+	svc, name, ok := strings.Cut(strings.TrimPrefix(rpc, "/"), "/")
+	if !ok {
+		return nil, fmt.Errorf("rpc %q must be in package.Service/Method form", rpc)
+	}
+	d, err := t.files.FindDescriptorByName(protoreflect.FullName(svc))
+	if err != nil {
+		return nil, errors.Wrapf(err, "service %s not found", svc)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", svc)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(name))
+	if md == nil {
+		return nil, fmt.Errorf("service %s has no method %s", svc, name)
+	}
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		return nil, fmt.Errorf("streaming method %s is not supported", rpc)
+	}
+	return md, nil
+}
+
+func readBody(c *gin.Context, msg proto.Message, limit int64) error {
+	if c.Request.Body == nil {
+		return nil
+	}
+	b, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, limit))
+	if err != nil {
+		return err
+	}
+	if len(strings.TrimSpace(string(b))) == 0 {
+		return nil
+	}
+	return unmarshalOpts.Unmarshal(b, msg)
+}
+
+func field(md protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	fd := md.Fields().ByName(protoreflect.Name(name))
+	if fd == nil {
+		fd = md.Fields().ByJSONName(name)
+	}
+	return fd
+}
+
+func setField(msg protoreflect.Message, name, value string) error {
+	fd := field(msg.Descriptor(), name)
+	if fd == nil {
+		return fmt.Errorf("unknown field %q", name)
+	}
+	if fd.IsList() || fd.IsMap() {
+		return fmt.Errorf("field %q is not a scalar", name)
+	}
+	v, err := parseScalar(fd, value)
+	if err != nil {
+		return err
+	}
+	msg.Set(fd, v)
+	return nil
+}
+
+func parseScalar(fd protoreflect.FieldDescriptor, s string) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(s), nil
+	case protoreflect.BoolKind:
+		v, err := strconv.ParseBool(s)
+		return protoreflect.ValueOfBool(v), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		v, err := strconv.ParseInt(s, 10, 32)
+		return protoreflect.ValueOfInt32(int32(v)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		v, err := strconv.ParseInt(s, 10, 64)
+		return protoreflect.ValueOfInt64(v), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		v, err := strconv.ParseUint(s, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(v)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		v, err := strconv.ParseUint(s, 10, 64)
+		return protoreflect.ValueOfUint64(v), err
+	case protoreflect.FloatKind:
+		v, err := strconv.ParseFloat(s, 32)
+		return protoreflect.ValueOfFloat32(float32(v)), err
+	case protoreflect.DoubleKind:
+		v, err := strconv.ParseFloat(s, 64)
+		return protoreflect.ValueOfFloat64(v), err
+	case protoreflect.BytesKind:
+		v, err := base64.StdEncoding.DecodeString(s)
+		return protoreflect.ValueOfBytes(v), err
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(s)); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+		v, err := strconv.ParseInt(s, 10, 32)
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(v)), err
+	}
+	return protoreflect.Value{}, fmt.Errorf("field %q of kind %s can not be set from a string", fd.Name(), fd.Kind())
+}
+
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Canceled:
+		return 499
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,215 @@
+package transcode
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	authv1 "github.com/vindosVP/snapigw/gen/go"
+)
+
+// fakeConn records the last request and answers with a fixed response.
+type fakeConn struct {
+	method string
+	in     []byte
+	out    proto.Message
+	err    error
+}
+
+func (f *fakeConn) Invoke(_ context.Context, method string, in, out any, _ ...grpc.CallOption) error {
+	f.method = method
+	f.in, _ = protojson.Marshal(in.(proto.Message))
+	if f.err != nil {
+		return f.err
+	}
+	b, _ := proto.Marshal(f.out)
+	return proto.Unmarshal(b, out.(proto.Message))
+}
+
+func (f *fakeConn) NewStream(context.Context, *grpc.StreamDesc, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+	return nil, status.Error(codes.Unimplemented, "streams are not supported")
+}
+
+func TestHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name       string
+		httpMethod string
+		path       string
+		url        string
+		rpc        string
+		params     map[string]string
+		body       string
+		out        proto.Message
+		err        error
+		wantStatus int
+		wantIn     map[string]any
+		wantData   map[string]any
+	}{
+		{
+			name:       "body and response",
+			httpMethod: http.MethodPost,
+			path:       "/register",
+			url:        "/register",
+			rpc:        "auth.Auth/Register",
+			body:       `{"email":"a@b.c","password":"secret","unknown":1}`,
+			out:        &authv1.RegisterResponse{UserId: 7},
+			wantStatus: http.StatusOK,
+			wantIn:     map[string]any{"email": "a@b.c", "password": "secret"},
+			wantData:   map[string]any{"userId": "7"},
+		},
+		{
+			name:       "mapped path parameter",
+			httpMethod: http.MethodPost,
+			path:       "/users/:id/banned",
+			url:        "/users/42/banned",
+			rpc:        "auth.Auth/SetBanned",
+			params:     map[string]string{"id": "user_id"},
+			body:       `{"isBanned":true}`,
+			out:        &authv1.SetBannedResponse{UserId: 42, IsBanned: true},
+			wantStatus: http.StatusOK,
+			wantIn:     map[string]any{"userId": "42", "isBanned": true},
+			wantData:   map[string]any{"userId": "42", "isBanned": true},
+		},
+		{
+			name:       "query parameters on get",
+			httpMethod: http.MethodGet,
+			path:       "/refresh",
+			url:        "/refresh?refreshToken=abc&other=1",
+			rpc:        "auth.Auth/Refresh",
+			out:        &authv1.RefreshResponse{},
+			wantStatus: http.StatusOK,
+			wantIn:     map[string]any{"refreshToken": "abc"},
+			wantData:   map[string]any{"accessToken": "", "refreshToken": ""},
+		},
+		{
+			name:       "invalid path parameter",
+			httpMethod: http.MethodPost,
+			path:       "/users/:id/banned",
+			url:        "/users/abc/banned",
+			rpc:        "auth.Auth/SetBanned",
+			params:     map[string]string{"id": "user_id"},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid body",
+			httpMethod: http.MethodPost,
+			path:       "/register",
+			url:        "/register",
+			rpc:        "auth.Auth/Register",
+			body:       `{"email":`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "body too large",
+			httpMethod: http.MethodPost,
+			path:       "/register",
+			url:        "/register",
+			rpc:        "auth.Auth/Register",
+			body:       `{"email":"a@b.c","password":"` + strings.Repeat("x", 128) + `"}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "upstream status",
+			httpMethod: http.MethodPost,
+			path:       "/register",
+			url:        "/register",
+			rpc:        "auth.Auth/Register",
+			err:        status.Error(codes.AlreadyExists, "user exists"),
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "upstream deadline",
+			httpMethod: http.MethodPost,
+			path:       "/register",
+			url:        "/register",
+			rpc:        "auth.Auth/Register",
+			err:        status.Error(codes.DeadlineExceeded, "deadline exceeded"),
+			wantStatus: http.StatusGatewayTimeout,
+		},
+	}
+	tc, err := New("", zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc.WithMaxBodyBytes(128)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &fakeConn{out: tt.out, err: tt.err}
+			h, err := tc.Handler(conn, tt.rpc, tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := gin.New()
+			r.Handle(tt.httpMethod, tt.path, h)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(tt.httpMethod, tt.url, strings.NewReader(tt.body)))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantIn == nil {
+				return
+			}
+			if conn.method != "/"+tt.rpc {
+				t.Errorf("method = %s, want /%s", conn.method, tt.rpc)
+			}
+			assertJSON(t, "request", conn.in, tt.wantIn)
+			var resp struct {
+				Data json.RawMessage `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			assertJSON(t, "response", resp.Data, tt.wantData)
+		})
+	}
+}
+
+func TestHandlerRejectsUnknownMethods(t *testing.T) {
+	tc, err := New("", zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		rpc    string
+		params map[string]string
+	}{
+		{rpc: "auth.Auth"},
+		{rpc: "auth.Missing/Register"},
+		{rpc: "auth.Auth/Missing"},
+		{rpc: "auth.RegisterRequest/Register"},
+		{rpc: "auth.Auth/Register", params: map[string]string{"id": "missing"}},
+	}
+	for _, tt := range tests {
+		if _, err := tc.Handler(&fakeConn{}, tt.rpc, tt.params); err == nil {
+			t.Errorf("Handler(%q, %v) succeeded, want error", tt.rpc, tt.params)
+		}
+	}
+}
+
+func assertJSON(t *testing.T, what string, got []byte, want map[string]any) {
+	t.Helper()
+	m := map[string]any{}
+	if err := json.Unmarshal(got, &m); err != nil {
+		t.Fatalf("%s: %v", what, err)
+	}
+	if len(m) != len(want) {
+		t.Errorf("%s = %v, want %v", what, m, want)
+	}
+	for k, v := range want {
+		if m[k] != v {
+			t.Errorf("%s[%s] = %v, want %v", what, k, m[k], v)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateHalfOpen
+	StateOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half_open"
+	case StateOpen:
+		return "open"
+	}
+	return "unknown"
+}
+
+const windowBuckets = 10
+
+var defaultBreakerCodes = []string{"UNAVAILABLE", "DEADLINE_EXCEEDED", "INTERNAL", "UNKNOWN"}
+
+// BreakerConfig opens the circuit once FailureRate of at least MinRequests
+// calls within Window failed with one of Codes. After OpenDuration up to
+// HalfOpenRequests probe calls are let through; if all succeed the circuit
+// closes, otherwise it opens again.
+type BreakerConfig struct {
+	FailureRate      float64       `yaml:"failureRate"`
+	MinRequests      int           `yaml:"minRequests"`
+	Window           time.Duration `yaml:"window"`
+	OpenDuration     time.Duration `yaml:"openDuration"`
+	HalfOpenRequests int           `yaml:"halfOpenRequests"`
+	Codes            []string      `yaml:"codes"`
+	// PerMethod keeps a separate circuit for every gRPC method.
+	PerMethod bool `yaml:"perMethod"`
+}
+
+func (c BreakerConfig) Validate() error {
+	if c.FailureRate <= 0 || c.FailureRate > 1 {
+		return fmt.Errorf("breaker failureRate must be in (0, 1]")
+	}
+	if c.MinRequests <= 0 || c.HalfOpenRequests <= 0 {
+		return fmt.Errorf("breaker minRequests and halfOpenRequests must be positive")
+	}
+	if c.Window <= 0 || c.OpenDuration <= 0 {
+		return fmt.Errorf("breaker window and openDuration must be positive")
+	}
+	for _, name := range c.Codes {
+		if _, err := parseCode(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OpenError is returned instead of calling an upstream whose circuit is open.
+// It converts to an Unavailable status.
+type OpenError struct {
+	Upstream   string
+	RetryAfter time.Duration
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("circuit breaker for %s is open", e.Upstream)
+}
+
+func (e *OpenError) GRPCStatus() *status.Status {
+	return status.New(codes.Unavailable, e.Error())
+}
+
+// SetRetryAfter sets the Retry-After header, in whole seconds, for an open circuit.
+func (e *OpenError) SetRetryAfter(c *gin.Context) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds()))))
+}
+
+type Breaker struct {
+	name     string
+	cfg      BreakerConfig
+	failures map[codes.Code]struct{}
+	onChange func(name, method string, from, to State)
+	now      func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+func NewBreaker(name string, cfg BreakerConfig) *Breaker {
+	names := cfg.Codes
+	if len(names) == 0 {
+		names = defaultBreakerCodes
+	}
+	failures := make(map[codes.Code]struct{}, len(names))
+	for _, n := range names {
+		code, _ := parseCode(n)
+		failures[code] = struct{}{}
+	}
+	return &Breaker{name: name, cfg: cfg, failures: failures, circuits: make(map[string]*circuit), now: time.Now}
+}
+
+// OnStateChange registers fn to be called on every state transition. Method
+// is empty unless the breaker is configured per method.
+func (b *Breaker) OnStateChange(fn func(name, method string, from, to State)) *Breaker {
+	b.onChange = fn
+	return b
+}
+
+func (b *Breaker) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		key := ""
+		if b.cfg.PerMethod {
+			key = method
+		}
+		if err := b.allow(key); err != nil {
+			return err
+		}
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		code := status.Code(err)
+		if code == codes.Canceled {
+			// The caller went away; this says nothing about the upstream.
+			b.release(key)
+			return err
+		}
+		_, failed := b.failures[code]
+		b.record(key, failed)
+		return err
+	}
+}
+
+// Check fails while any circuit of the breaker is open. An open circuit
+// already sheds load, so register it as an informational health check.
+func (b *Breaker) Check(_ context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var open []string
+	for key, c := range b.circuits {
+		if c.state == StateOpen {
+			if key == "" {
+				key = b.name
+			}
+			open = append(open, key)
+		}
+	}
+	if len(open) > 0 {
+		sort.Strings(open)
+		return fmt.Errorf("circuit open: %v", open)
+	}
+	return nil
+}
+
+type bucket struct {
+	epoch    int64
+	total    int
+	failures int
+}
+
+type circuit struct {
+	state   State
+	until   time.Time
+	probes  int
+	passed  int
+	buckets [windowBuckets]bucket
+}
+
+func (b *Breaker) circuit(key string) *circuit {
+	c, ok := b.circuits[key]
+	if !ok {
+		c = &circuit{}
+		b.circuits[key] = c
+	}
+	return c
+}
+
+func (b *Breaker) allow(key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuit(key)
+	now := b.now()
+	switch c.state {
+	case StateOpen:
+		if now.Before(c.until) {
+			return &OpenError{Upstream: b.name, RetryAfter: c.until.Sub(now)}
+		}
+		b.transition(key, c, StateHalfOpen)
+		c.probes, c.passed = 0, 0
+		fallthrough
+	case StateHalfOpen:
+		if c.probes >= b.cfg.HalfOpenRequests {
+			return &OpenError{Upstream: b.name, RetryAfter: time.Second}
+		}
+		c.probes++
+	}
+	return nil
+}
+
+func (b *Breaker) release(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c := b.circuit(key); c.state == StateHalfOpen && c.probes > 0 {
+		c.probes--
+	}
+}
+
+func (b *Breaker) record(key string, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuit(key)
+	now := b.now()
+	switch c.state {
+	case StateHalfOpen:
+		if failed {
+			b.open(key, c, now)
+			return
+		}
+		c.passed++
+		if c.passed >= b.cfg.HalfOpenRequests {
+			c.buckets = [windowBuckets]bucket{}
+			b.transition(key, c, StateClosed)
+		}
+	case StateClosed:
+		width := int64(b.cfg.Window) / windowBuckets
+		epoch := now.UnixNano() / width
+		bk := &c.buckets[epoch%windowBuckets]
+		if bk.epoch != epoch {
+			*bk = bucket{epoch: epoch}
+		}
+		bk.total++
+		if failed {
+			bk.failures++
+		}
+		var total, failures int
+		for _, x := range c.buckets {
+			if epoch-x.epoch < windowBuckets {
+				total += x.total
+				failures += x.failures
+			}
+		}
+		if total >= b.cfg.MinRequests && float64(failures)/float64(total) >= b.cfg.FailureRate {
+			b.open(key, c, now)
+		}
+	}
+}
+
+func (b *Breaker) open(key string, c *circuit, now time.Time) {
+	c.until = now.Add(b.cfg.OpenDuration)
+	b.transition(key, c, StateOpen)
+}
+
+func (b *Breaker) transition(key string, c *circuit, to State) {
+	from := c.state
+	c.state = to
+	if b.onChange != nil && from != to {
+		b.onChange(b.name, key, from, to)
+	}
+}
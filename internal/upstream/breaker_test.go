@@ -0,0 +1,212 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type call struct {
+	at       time.Duration
+	method   string
+	code     codes.Code
+	rejected bool
+	want     State
+}
+
+func TestBreaker(t *testing.T) {
+	cfg := BreakerConfig{FailureRate: 0.5, MinRequests: 4, Window: 10 * time.Second, OpenDuration: 5 * time.Second, HalfOpenRequests: 2}
+	opened := []call{
+		{code: codes.OK},
+		{code: codes.OK},
+		{code: codes.Unavailable},
+		{code: codes.DeadlineExceeded, want: StateOpen},
+	}
+	tests := []struct {
+		name      string
+		perMethod bool
+		calls     []call
+	}{
+		{
+			name:  "opens at the failure rate and rejects calls",
+			calls: append(opened, call{at: 4 * time.Second, rejected: true, want: StateOpen}),
+		},
+		{
+			name: "stays closed below min requests",
+			calls: []call{
+				{code: codes.Unavailable},
+				{code: codes.Unavailable},
+				{code: codes.Unavailable},
+			},
+		},
+		{
+			name: "ignores codes that are not failures",
+			calls: []call{
+				{code: codes.NotFound},
+				{code: codes.InvalidArgument},
+				{code: codes.Unauthenticated},
+				{code: codes.NotFound},
+			},
+		},
+		{
+			name: "forgets failures outside the window",
+			calls: []call{
+				{code: codes.Unavailable},
+				{code: codes.Unavailable},
+				{code: codes.Unavailable},
+				{at: 11 * time.Second, code: codes.Unavailable},
+			},
+		},
+		{
+			name: "closes once every probe succeeds",
+			calls: append(opened,
+				call{at: 5 * time.Second, code: codes.OK, want: StateHalfOpen},
+				call{at: 5 * time.Second, code: codes.OK, want: StateClosed},
+				call{at: 5 * time.Second, code: codes.Unavailable, want: StateClosed},
+			),
+		},
+		{
+			name: "reopens when a probe fails",
+			calls: append(opened,
+				call{at: 5 * time.Second, code: codes.Unavailable, want: StateOpen},
+				call{at: 9 * time.Second, rejected: true, want: StateOpen},
+				call{at: 10 * time.Second, code: codes.OK, want: StateHalfOpen},
+			),
+		},
+		{
+			name: "treats probes that are not failures as passed",
+			calls: append(opened,
+				call{at: 5 * time.Second, code: codes.OK, want: StateHalfOpen},
+				call{at: 5 * time.Second, code: codes.NotFound, want: StateClosed},
+			),
+		},
+		{
+			name: "does not count cancelled probes",
+			calls: append(opened,
+				call{at: 5 * time.Second, code: codes.Canceled, want: StateHalfOpen},
+				call{at: 5 * time.Second, code: codes.OK, want: StateHalfOpen},
+				call{at: 5 * time.Second, code: codes.OK, want: StateClosed},
+			),
+		},
+		{
+			name:      "keeps a circuit per method",
+			perMethod: true,
+			calls: []call{
+				{method: "/a", code: codes.Unavailable},
+				{method: "/a", code: codes.Unavailable},
+				{method: "/b", code: codes.OK},
+				{method: "/a", code: codes.Unavailable},
+				{method: "/a", code: codes.Unavailable, want: StateOpen},
+				{method: "/b", code: codes.OK},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := cfg
+			cfg.PerMethod = tt.perMethod
+			start := time.Unix(1700000000, 0)
+			var now time.Time
+			b := NewBreaker("auth", cfg)
+			b.now = func() time.Time { return now }
+			interceptor := b.UnaryClientInterceptor()
+			for i, c := range tt.calls {
+				now = start.Add(c.at)
+				method := c.method
+				if method == "" {
+					method = "/auth.Auth/Login"
+				}
+				invoked := false
+				err := interceptor(context.Background(), method, nil, nil, nil,
+					func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+						invoked = true
+						return status.Error(c.code, c.code.String())
+					})
+				var open *OpenError
+				if got := errors.As(err, &open); got != c.rejected {
+					t.Fatalf("call %d: rejected = %v (%v), want %v", i, got, err, c.rejected)
+				}
+				if invoked == c.rejected {
+					t.Fatalf("call %d: upstream invoked = %v", i, invoked)
+				}
+				key := ""
+				if tt.perMethod {
+					key = method
+				}
+				if got := b.circuits[key].state; got != c.want {
+					t.Fatalf("call %d: state = %s, want %s", i, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerLimitsProbes(t *testing.T) {
+	cfg := BreakerConfig{FailureRate: 1, MinRequests: 1, Window: time.Second, OpenDuration: time.Second, HalfOpenRequests: 2}
+	now := time.Unix(1700000000, 0)
+	b := NewBreaker("auth", cfg)
+	b.now = func() time.Time { return now }
+	b.record("", true)
+	now = now.Add(time.Second)
+	for i := 0; i < 2; i++ {
+		if err := b.allow(""); err != nil {
+			t.Fatalf("probe %d: %v", i, err)
+		}
+	}
+	if err := b.allow(""); err == nil {
+		t.Fatal("third concurrent probe was allowed")
+	}
+	b.release("")
+	if err := b.allow(""); err != nil {
+		t.Fatalf("probe after release: %v", err)
+	}
+}
+
+func TestBreakerStateChanges(t *testing.T) {
+	cfg := BreakerConfig{FailureRate: 1, MinRequests: 1, Window: time.Second, OpenDuration: time.Second, HalfOpenRequests: 1}
+	now := time.Unix(1700000000, 0)
+	var got []State
+	b := NewBreaker("auth", cfg).OnStateChange(func(name, method string, from, to State) {
+		if name != "auth" || method != "" {
+			t.Errorf("OnStateChange(%q, %q)", name, method)
+		}
+		got = append(got, to)
+	})
+	b.now = func() time.Time { return now }
+	interceptor := b.UnaryClientInterceptor()
+	invoke := func(code codes.Code) error {
+		return interceptor(context.Background(), "/auth.Auth/Login", nil, nil, nil,
+			func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+				return status.Error(code, "")
+			})
+	}
+
+	_ = invoke(codes.Unavailable)
+	if err := b.Check(context.Background()); err == nil {
+		t.Error("Check() = nil while open")
+	}
+	err := invoke(codes.OK)
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("open circuit returned %v, want Unavailable", err)
+	}
+	now = now.Add(time.Second)
+	_ = invoke(codes.OK)
+	if err := b.Check(context.Background()); err != nil {
+		t.Errorf("Check() = %v after closing", err)
+	}
+
+	want := []State{StateOpen, StateHalfOpen, StateClosed}
+	if len(got) != len(want) {
+		t.Fatalf("transitions = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("transitions = %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package upstream
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// Config is the call policy of one upstream, declared under upstreams in the
+// route table. Methods are keyed by full gRPC method name, e.g.
+// /auth.Auth/Refresh, and fall back to Timeout when not listed.
+type Config struct {
+	Timeout     time.Duration     `yaml:"timeout"`
+	RetryBudget *Budget           `yaml:"retryBudget"`
+	Methods     map[string]Method `yaml:"methods"`
+	Breaker     *BreakerConfig    `yaml:"breaker"`
+}
+
+type Method struct {
+	Timeout time.Duration `yaml:"timeout"`
+	// Retry must only be set for idempotent methods.
+	Retry *Retry `yaml:"retry"`
+}
+
+// Retry re-issues a call that failed with one of Codes, waiting a random
+// duration up to InitialBackoff*Multiplier^n, capped at MaxBackoff.
+type Retry struct {
+	MaxAttempts    int           `yaml:"maxAttempts"`
+	Codes          []string      `yaml:"codes"`
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	MaxBackoff     time.Duration `yaml:"maxBackoff"`
+	Multiplier     float64       `yaml:"multiplier"`
+}
+
+// Budget throttles retries across all methods of an upstream. Every failed
+// attempt takes a token and every success returns TokenRatio of one; retries
+// stop while fewer than half of MaxTokens are left.
+type Budget struct {
+	MaxTokens  float64 `yaml:"maxTokens"`
+	TokenRatio float64 `yaml:"tokenRatio"`
+}
+
+func (c Config) Validate() error {
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	if b := c.RetryBudget; b != nil {
+		if b.MaxTokens <= 0 || b.TokenRatio <= 0 {
+			return fmt.Errorf("retry budget maxTokens and tokenRatio must be positive")
+		}
+	}
+	if c.Breaker != nil {
+		if err := c.Breaker.Validate(); err != nil {
+			return err
+		}
+	}
+	for name, m := range c.Methods {
+		if m.Timeout < 0 {
+			return fmt.Errorf("method %s: timeout must not be negative", name)
+		}
+		if m.Retry != nil {
+			if err := m.Retry.Validate(); err != nil {
+				return fmt.Errorf("method %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (r Retry) Validate() error {
+	if r.MaxAttempts < 2 {
+		return fmt.Errorf("retry maxAttempts must be at least 2")
+	}
+	if len(r.Codes) == 0 {
+		return fmt.Errorf("retry codes are required")
+	}
+	for _, name := range r.Codes {
+		if _, err := parseCode(name); err != nil {
+			return err
+		}
+	}
+	if r.InitialBackoff <= 0 || r.MaxBackoff < r.InitialBackoff {
+		return fmt.Errorf("retry backoff must be positive and maxBackoff at least initialBackoff")
+	}
+	if r.Multiplier != 0 && r.Multiplier < 1 {
+		return fmt.Errorf("retry multiplier must be at least 1")
+	}
+	return nil
+}
+
+func parseCode(name string) (codes.Code, error) {
+	var c codes.Code
+	if err := c.UnmarshalJSON([]byte(strconv.Quote(name))); err != nil {
+		return 0, fmt.Errorf("unknown status code %q", name)
+	}
+	return c, nil
+}
@@ -0,0 +1,27 @@
+package upstream
+
+import (
+	"context"
+	"slices"
+
+	"google.golang.org/grpc"
+)
+
+// Except chains ics for every method but the listed ones, which are invoked
+// directly. It keeps probes such as health checks out of the breaker and the
+// call metrics, so that they report on the upstream rather than on the
+// gateway's own view of it.
+func Except(methods []string, ics ...grpc.UnaryClientInterceptor) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if slices.Contains(methods, method) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		for i := len(ics) - 1; i >= 0; i-- {
+			ic, next := ics[i], invoker
+			invoker = func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				return ic(ctx, method, req, reply, cc, next, opts...)
+			}
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -0,0 +1,39 @@
+package upstream
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+func TestExcept(t *testing.T) {
+	var calls []string
+	record := func(name string) grpc.UnaryClientInterceptor {
+		return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			calls = append(calls, name)
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+	}
+	ic := Except([]string{"/grpc.health.v1.Health/Check"}, record("first"), record("second"))
+	tests := []struct {
+		method string
+		want   []string
+	}{
+		{method: "/auth.Auth/Login", want: []string{"first", "second", "upstream"}},
+		{method: "/grpc.health.v1.Health/Check", want: []string{"upstream"}},
+		{method: "/auth.Auth/Login", want: []string{"first", "second", "upstream"}},
+	}
+	for _, tt := range tests {
+		calls = nil
+		err := ic(context.Background(), tt.method, nil, nil, nil,
+			func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+				calls = append(calls, "upstream")
+				return nil
+			})
+		if err != nil || !slices.Equal(calls, tt.want) {
+			t.Errorf("%s: calls = %v, %v, want %v", tt.method, calls, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package upstream
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const defaultMultiplier = 2
+
+type method struct {
+	timeout time.Duration
+	retry   *Retry
+	codes   map[codes.Code]struct{}
+}
+
+type budget struct {
+	mu     sync.Mutex
+	max    float64
+	ratio  float64
+	tokens float64
+}
+
+func (b *budget) success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.tokens = math.Min(b.max, b.tokens+b.ratio)
+	b.mu.Unlock()
+}
+
+// failure records a failed attempt and reports whether a retry is allowed.
+func (b *budget) failure() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Max(0, b.tokens-1)
+	return b.tokens > b.max/2
+}
+
+// UnaryClientInterceptor applies per-method deadlines and retries. The
+// deadline covers all attempts of a call, including back-off.
+func (c Config) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	methods := make(map[string]method, len(c.Methods))
+	for name, m := range c.Methods {
+		mt := method{timeout: m.Timeout, retry: m.Retry}
+		if mt.timeout == 0 {
+			mt.timeout = c.Timeout
+		}
+		if m.Retry != nil {
+			mt.codes = make(map[codes.Code]struct{}, len(m.Retry.Codes))
+			for _, name := range m.Retry.Codes {
+				code, _ := parseCode(name)
+				mt.codes[code] = struct{}{}
+			}
+		}
+		methods[name] = mt
+	}
+	var b *budget
+	if c.RetryBudget != nil {
+		b = &budget{max: c.RetryBudget.MaxTokens, ratio: c.RetryBudget.TokenRatio, tokens: c.RetryBudget.MaxTokens}
+	}
+	def := method{timeout: c.Timeout}
+
+	return func(ctx context.Context, name string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		m, ok := methods[name]
+		if !ok {
+			m = def
+		}
+		if m.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, m.timeout)
+			defer cancel()
+		}
+		for attempt := 1; ; attempt++ {
+			err := invoker(ctx, name, req, reply, cc, opts...)
+			if err == nil {
+				b.success()
+				return nil
+			}
+			if m.retry == nil || attempt >= m.retry.MaxAttempts {
+				return err
+			}
+			if _, ok := m.codes[status.Code(err)]; !ok || !b.failure() {
+				return err
+			}
+			t := time.NewTimer(backoff(*m.retry, attempt))
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return err
+			case <-t.C:
+			}
+		}
+	}
+}
+
+// backoff returns a fully jittered delay before the given retry.
+func backoff(r Retry, attempt int) time.Duration {
+	mult := r.Multiplier
+	if mult == 0 {
+		mult = defaultMultiplier
+	}
+	d := float64(r.InitialBackoff) * math.Pow(mult, float64(attempt-1))
+	d = math.Min(d, float64(r.MaxBackoff))
+	return time.Duration(rand.Int64N(int64(d) + 1))
+}
@@ -0,0 +1,175 @@
+package upstream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const refresh = "/auth.Auth/Refresh"
+
+// invoker fails with errs in turn and succeeds once they run out.
+func invoker(errs ...codes.Code) (grpc.UnaryInvoker, *int) {
+	calls := 0
+	return func(ctx context.Context, _ string, _, _ interface{}, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+		calls++
+		if calls <= len(errs) {
+			return status.Error(errs[calls-1], "failed")
+		}
+		return nil
+	}, &calls
+}
+
+func retryConfig(budget *Budget) Config {
+	return Config{
+		Timeout:     time.Second,
+		RetryBudget: budget,
+		Methods: map[string]Method{
+			refresh: {Retry: &Retry{
+				MaxAttempts:    3,
+				Codes:          []string{"UNAVAILABLE"},
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     time.Millisecond,
+			}},
+		},
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		errs      []codes.Code
+		wantCalls int
+		wantCode  codes.Code
+	}{
+		{name: "success", method: refresh, wantCalls: 1, wantCode: codes.OK},
+		{name: "retried to success", method: refresh, errs: []codes.Code{codes.Unavailable, codes.Unavailable}, wantCalls: 3, wantCode: codes.OK},
+		{name: "attempts exhausted", method: refresh, errs: []codes.Code{codes.Unavailable, codes.Unavailable, codes.Unavailable}, wantCalls: 3, wantCode: codes.Unavailable},
+		{name: "code not retried", method: refresh, errs: []codes.Code{codes.InvalidArgument}, wantCalls: 1, wantCode: codes.InvalidArgument},
+		{name: "method without retry", method: "/auth.Auth/Login", errs: []codes.Code{codes.Unavailable}, wantCalls: 1, wantCode: codes.Unavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv, calls := invoker(tt.errs...)
+			err := retryConfig(nil).UnaryClientInterceptor()(context.Background(), tt.method, nil, nil, nil, inv)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("code = %v, want %v", status.Code(err), tt.wantCode)
+			}
+			if *calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", *calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	// Retries stop once fewer than half of the 4 tokens are left.
+	ic := retryConfig(&Budget{MaxTokens: 4, TokenRatio: 0.5}).UnaryClientInterceptor()
+	down := []codes.Code{codes.Unavailable, codes.Unavailable, codes.Unavailable}
+	type step struct {
+		name      string
+		errs      []codes.Code
+		wantCalls int
+	}
+	// 4 tokens: 3 left after the first failure, 2 after the retry.
+	steps := []step{
+		{name: "outage is retried once", errs: down, wantCalls: 2},
+		{name: "no retries while depleted", errs: down, wantCalls: 1},
+	}
+	// 1 token left; seven successes bring it back to 4.
+	for i := 0; i < 7; i++ {
+		steps = append(steps, step{name: "success", wantCalls: 1})
+	}
+	steps = append(steps, step{name: "retries resume", errs: down, wantCalls: 2})
+	for _, st := range steps {
+		inv, calls := invoker(st.errs...)
+		_ = ic(context.Background(), refresh, nil, nil, nil, inv)
+		if *calls != st.wantCalls {
+			t.Errorf("%s: calls = %d, want %d", st.name, *calls, st.wantCalls)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	c := retryConfig(nil)
+	c.Methods["/auth.Auth/Login"] = Method{Timeout: 50 * time.Millisecond}
+	ic := c.UnaryClientInterceptor()
+	tests := []struct {
+		method string
+		want   time.Duration
+	}{
+		{method: "/auth.Auth/Login", want: 50 * time.Millisecond},
+		{method: refresh, want: time.Second},
+		{method: "/auth.Auth/Register", want: time.Second},
+	}
+	for _, tt := range tests {
+		var got time.Duration
+		_ = ic(context.Background(), tt.method, nil, nil, nil, func(ctx context.Context, _ string, _, _ interface{}, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+			deadline, ok := ctx.Deadline()
+			if !ok {
+				t.Fatalf("%s: no deadline", tt.method)
+			}
+			got = time.Until(deadline)
+			return nil
+		})
+		if got > tt.want || got < tt.want-20*time.Millisecond {
+			t.Errorf("%s: deadline in %v, want about %v", tt.method, got, tt.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	r := Retry{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 3}
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{attempt: 1, max: 100 * time.Millisecond},
+		{attempt: 2, max: 300 * time.Millisecond},
+		{attempt: 3, max: 900 * time.Millisecond},
+		{attempt: 4, max: time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			if d := backoff(r, tt.attempt); d < 0 || d > tt.max {
+				t.Fatalf("backoff(%d) = %v, want within [0, %v]", tt.attempt, d, tt.max)
+			}
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	retry := func(mutate func(r *Retry)) Config {
+		c := retryConfig(nil)
+		r := *c.Methods[refresh].Retry
+		mutate(&r)
+		c.Methods = map[string]Method{refresh: {Retry: &r}}
+		return c
+	}
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{name: "valid", config: retryConfig(&Budget{MaxTokens: 10, TokenRatio: 0.1})},
+		{name: "negative timeout", config: Config{Timeout: -1}, wantErr: true},
+		{name: "empty budget", config: Config{RetryBudget: &Budget{}}, wantErr: true},
+		{name: "single attempt", config: retry(func(r *Retry) { r.MaxAttempts = 1 }), wantErr: true},
+		{name: "no codes", config: retry(func(r *Retry) { r.Codes = nil }), wantErr: true},
+		{name: "unknown code", config: retry(func(r *Retry) { r.Codes = []string{"BROKEN"} }), wantErr: true},
+		{name: "max below initial backoff", config: retry(func(r *Retry) { r.MaxBackoff = 0 }), wantErr: true},
+		{name: "shrinking multiplier", config: retry(func(r *Retry) { r.Multiplier = 0.5 }), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -3,8 +3,10 @@ package response
 import "github.com/gin-gonic/gin"
 
 type HttpResponse struct {
-	Message string      `json:"message"`
-	Data    interface{} `json:"data"`
+	Message   string      `json:"message"`
+	Code      string      `json:"code,omitempty"`
+	RequestId string      `json:"requestId,omitempty"`
+	Data      interface{} `json:"data"`
 }
 
 func Ok(c *gin.Context, status int, data interface{}) {
@@ -25,24 +27,47 @@ func OkMsg(c *gin.Context, status int, data interface{}, msg string) {
 
 func Err(c *gin.Context, status int, msg string) {
 	resp := HttpResponse{
-		Message: msg,
-		Data:    nil,
+		Message:   msg,
+		RequestId: c.GetString("requestId"),
+		Data:      nil,
 	}
 	c.JSON(status, resp)
 }
 
 func AbortErr(c *gin.Context, status int, msg string) {
 	resp := HttpResponse{
-		Message: msg,
-		Data:    nil,
+		Message:   msg,
+		RequestId: c.GetString("requestId"),
+		Data:      nil,
+	}
+	c.AbortWithStatusJSON(status, resp)
+}
+
+func AbortErrCode(c *gin.Context, status int, code string, msg string) {
+	resp := HttpResponse{
+		Message:   msg,
+		Code:      code,
+		RequestId: c.GetString("requestId"),
+		Data:      nil,
 	}
 	c.AbortWithStatusJSON(status, resp)
 }
 
+func ErrCodeData(c *gin.Context, status int, code string, msg string, data interface{}) {
+	resp := HttpResponse{
+		Message:   msg,
+		Code:      code,
+		RequestId: c.GetString("requestId"),
+		Data:      data,
+	}
+	c.JSON(status, resp)
+}
+
 func ErrData(c *gin.Context, status int, msg string, data interface{}) {
 	resp := HttpResponse{
-		Message: msg,
-		Data:    data,
+		Message:   msg,
+		RequestId: c.GetString("requestId"),
+		Data:      data,
 	}
 	c.JSON(status, resp)
 }
@@ -14,19 +14,23 @@ const (
 	envTest = "test"
 )
 
-func SetupLogger(env string, serviceName string) zerolog.Logger {
+// SetupLogger builds the service logger. Values of sensitive fields (passwords,
+// tokens, secrets, authorization headers, emails and any of redactKeys) are
+// masked in every event, as are struct fields tagged log:"redact".
+func SetupLogger(env string, serviceName string, redactKeys ...string) zerolog.Logger {
 	zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
+	zerolog.InterfaceMarshalFunc = marshalRedacted
 	var zl zerolog.Logger
 	switch env {
 	case envDev:
 		output := zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339}
-		zl = zerolog.New(output)
+		zl = zerolog.New(newRedactWriter(output, redactKeys))
 		zl.Level(zerolog.DebugLevel)
 	case envProd:
-		zl = zerolog.New(os.Stdout)
+		zl = zerolog.New(newRedactWriter(os.Stdout, redactKeys))
 		zl.Level(zerolog.InfoLevel)
 	case envTest:
-		zl = zerolog.New(os.Stdout)
+		zl = zerolog.New(newRedactWriter(os.Stdout, redactKeys))
 		zl.Level(zerolog.Disabled)
 	}
 	return zl.With().Timestamp().Str("service", serviceName).Logger()
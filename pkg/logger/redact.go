@@ -0,0 +1,345 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+const redacted = "[REDACTED]"
+
+// TagRedact marks struct fields whose values must never reach the logs:
+//
+//	Password string `json:"password" log:"redact"`
+const TagRedact = "redact"
+
+var (
+	secretSuffixes = []string{"password", "passwd", "secret", "token", "authorization", "apikey", "cookie"}
+	emailSuffixes  = []string{"email"}
+)
+
+// redactWriter rewrites every JSON log line, masking values of sensitive keys
+// at any depth while preserving the order of the remaining fields.
+type redactWriter struct {
+	next  io.Writer
+	extra map[string]struct{}
+}
+
+func newRedactWriter(next io.Writer, keys []string) *redactWriter {
+	extra := make(map[string]struct{}, len(keys))
+	for _, k := range keys {
+		extra[normalizeKey(k)] = struct{}{}
+	}
+	return &redactWriter{next: next, extra: extra}
+}
+
+func (w *redactWriter) Write(p []byte) (int, error) {
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+	out := &bytes.Buffer{}
+	if err := w.value(dec, out); err != nil {
+		// Not a JSON event; pass it through untouched rather than lose it.
+		return w.next.Write(p)
+	}
+	out.WriteByte('\n')
+	if _, err := w.next.Write(out.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *redactWriter) value(dec *json.Decoder, out *bytes.Buffer) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '[' {
+			return w.array(dec, out)
+		}
+		return w.object(dec, out)
+	default:
+		return writeJSON(out, t)
+	}
+}
+
+func (w *redactWriter) object(dec *json.Decoder, out *bytes.Buffer) error {
+	out.WriteByte('{')
+	for first := true; dec.More(); first = false {
+		if !first {
+			out.WriteByte(',')
+		}
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+		if err := writeJSON(out, key); err != nil {
+			return err
+		}
+		out.WriteByte(':')
+		switch w.mode(key) {
+		case modeSecret:
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+			if err := writeJSON(out, redacted); err != nil {
+				return err
+			}
+		case modeEmail:
+			var v interface{}
+			if err := dec.Decode(&v); err != nil {
+				return err
+			}
+			s, ok := v.(string)
+			if !ok {
+				s = redacted
+			}
+			if err := writeJSON(out, MaskEmail(s)); err != nil {
+				return err
+			}
+		default:
+			if err := w.value(dec, out); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	out.WriteByte('}')
+	return nil
+}
+
+func (w *redactWriter) array(dec *json.Decoder, out *bytes.Buffer) error {
+	out.WriteByte('[')
+	for first := true; dec.More(); first = false {
+		if !first {
+			out.WriteByte(',')
+		}
+		if err := w.value(dec, out); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	out.WriteByte(']')
+	return nil
+}
+
+type mode int
+
+const (
+	modeNone mode = iota
+	modeSecret
+	modeEmail
+)
+
+func (w *redactWriter) mode(key string) mode {
+	k := normalizeKey(key)
+	if _, ok := w.extra[k]; ok {
+		return modeSecret
+	}
+	for _, s := range secretSuffixes {
+		if strings.HasSuffix(k, s) {
+			return modeSecret
+		}
+	}
+	for _, s := range emailSuffixes {
+		if strings.HasSuffix(k, s) {
+			return modeEmail
+		}
+	}
+	return modeNone
+}
+
+func normalizeKey(key string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", "_", "", ".", "").Replace(key))
+}
+
+func writeJSON(out *bytes.Buffer, v interface{}) error {
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	out.Truncate(out.Len() - 1)
+	return nil
+}
+
+// MaskEmail keeps the first character of the local part and the domain.
+func MaskEmail(email string) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" {
+		return redacted
+	}
+	return local[:1] + "***@" + domain
+}
+
+var redactTypes sync.Map
+
+// marshalRedacted is installed as zerolog's interface marshaler so that
+// fields tagged log:"redact" are masked wherever a value is logged.
+func marshalRedacted(v interface{}) ([]byte, error) {
+	return json.Marshal(redactValue(reflect.ValueOf(v)))
+}
+
+func redactValue(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		return redactValue(v.Elem())
+	}
+	if !hasRedactTag(v.Type()) {
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return redactValue(v.Elem())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = redactValue(v.Index(i))
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		out := make(map[string]interface{}, v.Len())
+		for it := v.MapRange(); it.Next(); {
+			out[toString(it.Key())] = redactValue(it.Value())
+		}
+		return out
+	case reflect.Struct:
+		if !v.CanAddr() {
+			addressable := reflect.New(v.Type()).Elem()
+			addressable.Set(v)
+			v = addressable
+		}
+		out := make(map[string]interface{}, v.NumField())
+		redactStruct(v, out)
+		return out
+	}
+	return v.Interface()
+}
+
+func redactStruct(v reflect.Value, out map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() && !promoted(f) {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		fv := v.Field(i)
+		if f.Anonymous && name == "" && indirect(f.Type).Kind() == reflect.Struct {
+			if fv.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if !fv.CanInterface() {
+				// encoding/json promotes the exported fields of an embedded
+				// unexported struct, so they must be readable here as well.
+				fv = reflect.NewAt(fv.Type(), unsafe.Pointer(fv.UnsafeAddr())).Elem()
+			}
+			redactStruct(fv, out)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if strings.Contains(opts, "omitempty") && fv.IsZero() {
+			continue
+		}
+		if f.Tag.Get("log") == TagRedact {
+			out[name] = redacted
+			continue
+		}
+		out[name] = redactValue(fv)
+	}
+}
+
+// hasRedactTag reports whether values of t may contain fields tagged
+// log:"redact". Types implementing json.Marshaler are left alone.
+func hasRedactTag(t reflect.Type) bool {
+	if cached, ok := redactTypes.Load(t); ok {
+		return cached.(bool)
+	}
+	redactTypes.Store(t, false)
+	found := scanRedactTag(t)
+	redactTypes.Store(t, found)
+	return found
+}
+
+func scanRedactTag(t reflect.Type) bool {
+	if t.Implements(reflect.TypeOf((*json.Marshaler)(nil)).Elem()) {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Interface:
+		// The dynamic type is only known per value.
+		return true
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		return hasRedactTag(t.Elem())
+	case reflect.Map:
+		return hasRedactTag(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() && !promoted(f) {
+				continue
+			}
+			if f.Tag.Get("log") == TagRedact || hasRedactTag(f.Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// promoted reports whether f is an embedded unexported struct whose exported
+// fields encoding/json marshals as if they were declared on the outer struct.
+func promoted(f reflect.StructField) bool {
+	return f.Anonymous && f.Type.Kind() == reflect.Struct
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Pointer {
+		return t.Elem()
+	}
+	return t
+}
+
+func toString(v reflect.Value) string {
+	if v.Kind() == reflect.String {
+		return v.String()
+	}
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		return ""
+	}
+	return strings.Trim(string(b), `"`)
+}
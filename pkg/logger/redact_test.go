@@ -0,0 +1,151 @@
+package logger
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRedactWriter(t *testing.T) {
+	tests := []struct {
+		name  string
+		extra []string
+		in    string
+		want  string
+	}{
+		{
+			name: "secret suffixes",
+			in:   `{"password":"p","refresh_token":"t","Authorization":"Bearer x","x-api-key":"k","msg":"ok"}`,
+			want: `{"password":"[REDACTED]","refresh_token":"[REDACTED]","Authorization":"[REDACTED]","x-api-key":"[REDACTED]","msg":"ok"}`,
+		},
+		{
+			name: "emails are masked",
+			in:   `{"email":"alice@example.com","userEmail":"b@x.org","badEmail":"nope","numEmail":1}`,
+			want: `{"email":"a***@example.com","userEmail":"b***@x.org","badEmail":"[REDACTED]","numEmail":"[REDACTED]"}`,
+		},
+		{
+			name: "nested objects and arrays",
+			in:   `{"req":{"headers":[{"cookie":"c"},{"accept":"*/*"}],"body":{"secret":{"a":1}}}}`,
+			want: `{"req":{"headers":[{"cookie":"[REDACTED]"},{"accept":"*/*"}],"body":{"secret":"[REDACTED]"}}}`,
+		},
+		{
+			name:  "extra keys",
+			extra: []string{"ssn", "card-number"},
+			in:    `{"SSN":"123","card_number":"4111","level":"info"}`,
+			want:  `{"SSN":"[REDACTED]","card_number":"[REDACTED]","level":"info"}`,
+		},
+		{
+			name: "field order and numbers are kept",
+			in:   `{"b":1.50,"a":12345678901234567890,"c":null,"d":true,"e":"<html>"}`,
+			want: `{"b":1.50,"a":12345678901234567890,"c":null,"d":true,"e":"<html>"}`,
+		},
+		{
+			name: "non json passes through",
+			in:   "plain text line\n",
+			want: "plain text line",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			w := newRedactWriter(out, tt.extra)
+			n, err := w.Write([]byte(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != len(tt.in) {
+				t.Errorf("Write() = %d, want %d", n, len(tt.in))
+			}
+			if got := string(bytes.TrimSuffix(out.Bytes(), []byte("\n"))); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaskEmail(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{in: "alice@example.com", want: "a***@example.com"},
+		{in: "a@b", want: "a***@b"},
+		{in: "@example.com", want: redacted},
+		{in: "not an email", want: redacted},
+	}
+	for _, tt := range tests {
+		if got := MaskEmail(tt.in); got != tt.want {
+			t.Errorf("MaskEmail(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+type credentials struct {
+	User     string `json:"user"`
+	Password string `json:"password" log:"redact"`
+	Token    string `json:"token,omitempty" log:"redact"`
+	Hidden   string `json:"-"`
+}
+
+type login struct {
+	credentials
+	Attempts []credentials          `json:"attempts"`
+	ByName   map[string]credentials `json:"byName"`
+	Next     *credentials           `json:"next"`
+}
+
+type plain struct {
+	Name string `json:"name"`
+}
+
+func TestMarshalRedacted(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+		want string
+	}{
+		{
+			name: "tagged fields",
+			in:   credentials{User: "u", Password: "p", Token: "t", Hidden: "h"},
+			want: `{"password":"[REDACTED]","token":"[REDACTED]","user":"u"}`,
+		},
+		{
+			name: "omitempty skips empty tagged fields",
+			in:   &credentials{User: "u"},
+			want: `{"password":"[REDACTED]","user":"u"}`,
+		},
+		{
+			name: "embedded, slices, maps and pointers",
+			in: login{
+				credentials: credentials{User: "u", Password: "p"},
+				Attempts:    []credentials{{User: "a", Password: "p"}},
+				ByName:      map[string]credentials{"b": {User: "b", Password: "p"}},
+			},
+			want: `{"attempts":[{"password":"[REDACTED]","user":"a"}],"byName":{"b":{"password":"[REDACTED]","user":"b"}},"next":null,"password":"[REDACTED]","user":"u"}`,
+		},
+		{
+			name: "tags inside an embedded unexported struct",
+			in:   struct{ credentials }{credentials{User: "u", Password: "p"}},
+			want: `{"password":"[REDACTED]","user":"u"}`,
+		},
+		{
+			name: "untagged types are marshalled as usual",
+			in:   plain{Name: "n"},
+			want: `{"name":"n"}`,
+		},
+		{
+			name: "nil",
+			in:   nil,
+			want: `null`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := marshalRedacted(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("got  %s\nwant %s", b, tt.want)
+			}
+		})
+	}
+}